@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sendMethods are the methods that post to the chat in their chatID
+// argument, and so are subject to --allowed-chats.
+var sendMethods = map[string]bool{
+	"SendMessage":    true,
+	"SendMediaGroup": true,
+	"SendChatAction": true,
+	"ForwardMessage": true,
+	"CopyMessage":    true,
+	"SendPoll":       true,
+	"SendLocation":   true,
+	"SendVenue":      true,
+	"SendContact":    true,
+	"SendDice":       true,
+	"SendInvoice":    true,
+	"SendPhoto":      true,
+	"SendVideo":      true,
+	"SendAudio":      true,
+	"SendDocument":   true,
+	"SendVoice":      true,
+	"SendSticker":    true,
+	"SendTemplate":   true,
+	"SendToTopic":    true,
+}
+
+// allowedChats, set by --allowed-chats, is the only chats send methods may
+// post to. Nil allows every chat.
+var allowedChats map[string]bool
+
+// parseAllowedChats reads the comma-separated --allowed-chats value.
+func parseAllowedChats(list string) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	chats := map[string]bool{}
+	for _, chat := range strings.Split(list, ",") {
+		chat = strings.TrimSpace(chat)
+		if chat == "" || chat == "@" {
+			return nil, fmt.Errorf("--allowed-chats has an empty entry")
+		}
+		chats[normalizeChat(chat)] = true
+	}
+	return chats, nil
+}
+
+// normalizeChat lowercases @usernames, which Telegram matches without
+// regard to case.
+func normalizeChat(chatID string) string {
+	if strings.HasPrefix(chatID, "@") {
+		return strings.ToLower(chatID)
+	}
+	return chatID
+}
+
+// checkChatAllowed rejects a send to a chat that is not in allowedChats. A
+// chat is matched as given: a numeric ID does not match the @username of
+// the same chat. For a multi-chat SendMessage every chat must be allowed.
+func checkChatAllowed(method string, args map[string]any) error {
+	if allowedChats == nil || !sendMethods[method] {
+		return nil
+	}
+
+	var chats []string
+	if chatID, ok := args["chatID"].(string); ok {
+		chats = []string{chatID}
+	} else if ids, err := stringsArg(args, "chatID"); err == nil {
+		chats = ids
+	}
+	for _, chat := range chats {
+		if !allowedChats[normalizeChat(chat)] {
+			return fmt.Errorf("%w: %s is not in the plugin's allowed chats", errChatNotPermitted, chat)
+		}
+	}
+	return nil
+}
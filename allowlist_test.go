@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// setAllowedChats sets --allowed-chats for one test.
+func setAllowedChats(t *testing.T, list string) {
+	t.Helper()
+	chats, err := parseAllowedChats(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := allowedChats
+	allowedChats = chats
+	t.Cleanup(func() { allowedChats = saved })
+}
+
+func TestParseAllowedChats(t *testing.T) {
+	if chats, err := parseAllowedChats("  "); chats != nil || err != nil {
+		t.Errorf("empty list = %v, %v; want nil, nil", chats, err)
+	}
+	for _, list := range []string{"1,,2", "1, @", ","} {
+		if _, err := parseAllowedChats(list); err == nil {
+			t.Errorf("parseAllowedChats(%q) accepted an empty entry", list)
+		}
+	}
+}
+
+func TestCheckChatAllowed(t *testing.T) {
+	setAllowedChats(t, "-1001234567890, 42, @MyChannel")
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		chatID  any
+		allowed bool
+	}{
+		{"numeric ID", "SendMessage", "42", true},
+		{"negative numeric ID", "SendPhoto", "-1001234567890", true},
+		{"other numeric ID", "SendMessage", "43", false},
+		{"username", "SendMessage", "@MyChannel", true},
+		{"username in another case", "SendMessage", "@mychannel", true},
+		{"other username", "SendMessage", "@OtherChannel", false},
+		// Chats are matched as given, not resolved.
+		{"username of an allowed ID", "SendMessage", "@fortytwo", false},
+		{"fan-out all allowed", "SendMessage", []any{"42", "@MYCHANNEL"}, true},
+		{"fan-out one disallowed", "SendMessage", []any{"42", "43", "@MyChannel"}, false},
+		{"fan-out as []string", "SendMessage", []string{"42", "43"}, false},
+		{"not a send method", "GetChat", "43", true},
+		{"not a send method, fan-out", "DeleteMessage", []any{"43"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkChatAllowed(tc.method, map[string]any{"chatID": tc.chatID})
+			if tc.allowed && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tc.allowed && !errors.Is(err, errChatNotPermitted) {
+				t.Errorf("err = %v, want errChatNotPermitted", err)
+			}
+		})
+	}
+}
+
+func TestCheckChatAllowedDisabled(t *testing.T) {
+	setAllowedChats(t, "")
+	if err := checkChatAllowed("SendMessage", map[string]any{"chatID": "43"}); err != nil {
+		t.Errorf("rejected with no --allowed-chats: %v", err)
+	}
+}
+
+func TestFanOutRejectedBeforeSending(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	setAllowedChats(t, "1,2")
+
+	res := callRaw(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": []any{"1", "3", "2"}, "text": "hi"})
+	if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeChatNotPermitted {
+		t.Fatalf("Success=%v errorCode=%v, want %s", res.Success, data["errorCode"], codeChatNotPermitted)
+	}
+	if got := stub.count("sendMessage"); got != 0 {
+		t.Errorf("sendMessage called %d times, want 0", got)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// mapsArg reads an array of objects. Go callers typically send
+// []map[string]any while gob-decoded generic payloads arrive as []any.
+func mapsArg(args map[string]any, key string) ([]map[string]any, error) {
+	switch v := args[key].(type) {
+	case nil:
+		return nil, nil
+	case []map[string]any:
+		return v, nil
+	case []any:
+		out := make([]map[string]any, len(v))
+		for i, item := range v {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return nil, argErrorf("%s[%d] must be an object", key, i)
+			}
+			out[i] = m
+		}
+		return out, nil
+	default:
+		return nil, argErrorf("%s must be an array of objects", key)
+	}
+}
+
+// bytesValue accepts raw bytes or a base64-encoded string.
+func bytesValue(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, argErrorf("invalid base64 data: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, argErrorf("data must be bytes or a base64 string")
+	}
+}
+
+// intArg reads an optional integer argument. Numbers that crossed a JSON
+// boundary arrive as float64, so integral floats are accepted too, as are
+// numeric strings from callers that build args from text.
+func intArg(args map[string]any, key string) (int64, bool, error) {
+	// Integers are read directly so IDs beyond float64 precision survive.
+	switch v := args[key].(type) {
+	case int:
+		return int64(v), true, nil
+	case int32:
+		return int64(v), true, nil
+	case int64:
+		return v, true, nil
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n, true, nil
+		}
+	}
+
+	v, ok, err := numberArg(args, key)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	if v != math.Trunc(v) {
+		return 0, false, argErrorf("%s must be an integer", key)
+	}
+	// Converting a float64 outside the int64 range is implementation
+	// defined; float64(math.MaxInt64) is 2^63, itself out of range.
+	if v < math.MinInt64 || v >= math.MaxInt64 {
+		return 0, false, argErrorf("%s is out of range", key)
+	}
+	return int64(v), true, nil
+}
+
+// numberArg reads an optional numeric argument of any Go numeric type, or
+// a string holding a decimal number.
+func numberArg(args map[string]any, key string) (float64, bool, error) {
+	switch v := args[key].(type) {
+	case nil:
+		return 0, false, nil
+	case int:
+		return float64(v), true, nil
+	case int8:
+		return float64(v), true, nil
+	case int16:
+		return float64(v), true, nil
+	case int32:
+		return float64(v), true, nil
+	case int64:
+		return float64(v), true, nil
+	case uint:
+		return float64(v), true, nil
+	case uint8:
+		return float64(v), true, nil
+	case uint16:
+		return float64(v), true, nil
+	case uint32:
+		return float64(v), true, nil
+	case uint64:
+		return float64(v), true, nil
+	case float32:
+		return float64(v), true, nil
+	case float64:
+		return v, true, nil
+	case string:
+		if f, ok := parseNumber(v); ok {
+			return f, true, nil
+		}
+		return 0, false, argErrorf("%s must be a number, got %q", key, v)
+	default:
+		return 0, false, argErrorf("%s must be a number", key)
+	}
+}
+
+// parseNumber parses a finite decimal number, ignoring surrounding space.
+func parseNumber(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// boolArg reads an optional boolean argument.
+func boolArg(args map[string]any, key string) (bool, bool, error) {
+	switch v := args[key].(type) {
+	case nil:
+		return false, false, nil
+	case bool:
+		return v, true, nil
+	default:
+		return false, false, argErrorf("%s must be a boolean", key)
+	}
+}
+
+// idArg reads an identifier such as a message ID that callers may send either
+// as a string or as a number, returning it in its decimal string form.
+func idArg(args map[string]any, key string) (string, error) {
+	if s, ok := args[key].(string); ok {
+		return s, nil
+	}
+	v, ok, err := intArg(args, key)
+	if err != nil || !ok {
+		return "", err
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+// stringsArg reads an array of strings, sent either as []string or as a
+// generic []any.
+func stringsArg(args map[string]any, key string) ([]string, error) {
+	switch v := args[key].(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return v, nil
+	case []any:
+		out := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, argErrorf("%s[%d] must be a string", key, i)
+			}
+			out[i] = s
+		}
+		return out, nil
+	default:
+		return nil, argErrorf("%s must be an array of strings", key)
+	}
+}
+
+// renamedArg returns args with the value of old, an earlier documented
+// spelling of key, moved to key. args itself is left unchanged, and
+// setting both spellings is an error.
+func renamedArg(args map[string]any, key, old string) (map[string]any, error) {
+	v, ok := args[old]
+	if !ok {
+		return args, nil
+	}
+	if _, ok := args[key]; ok {
+		return nil, argErrorf("only one of %s and %s may be set", key, old)
+	}
+	renamed := make(map[string]any, len(args))
+	for k, val := range args {
+		renamed[k] = val
+	}
+	delete(renamed, old)
+	renamed[key] = v
+	return renamed, nil
+}
+
+// jsonArg reads an argument the Bot API expects as a JSON-serialized
+// object, such as reply_markup. Objects and arrays are encoded; a string is
+// taken to be JSON already.
+func jsonArg(args map[string]any, key string) (string, bool, error) {
+	switch v := args[key].(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		if !json.Valid([]byte(v)) {
+			return "", false, argErrorf("%s must be valid JSON", key)
+		}
+		return v, true, nil
+	case map[string]any, []any, []map[string]any:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", false, argErrorf("%s: %v", key, err)
+		}
+		return string(encoded), true, nil
+	default:
+		return "", false, argErrorf("%s must be an object", key)
+	}
+}
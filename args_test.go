@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIntArg(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		value   any
+		want    int64
+		wantOK  bool
+		wantErr bool
+	}{
+		{"missing", nil, 0, false, false},
+		{"int", 42, 42, true, false},
+		{"int32", int32(-7), -7, true, false},
+		{"int64 beyond float64 precision", int64(math.MaxInt64), math.MaxInt64, true, false},
+		{"whole float64", float64(4000), 4000, true, false},
+		{"fractional float64", 1.5, 0, false, true},
+		{"float64 above int64 range", 1e19, 0, false, true},
+		{"float64 below int64 range", -1e19, 0, false, true},
+		{"float64 of 2^63", float64(math.MaxInt64), 0, false, true},
+		{"whole numeric string", "4000", 4000, true, false},
+		{"numeric string with spaces", " -100123 ", -100123, true, false},
+		{"whole decimal string", "12.0", 12, true, false},
+		{"fractional numeric string", "1.5", 0, false, true},
+		{"out of range numeric string", "1e19", 0, false, true},
+		{"non-numeric string", "abc", 0, false, true},
+		{"boolean", true, 0, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, err := intArg(map[string]any{"n": tc.value}, "n")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("intArg(%#v) = %d, want an error", tc.value, got)
+				}
+				if code := errorCode(err); code != codeInvalidArgs {
+					t.Errorf("error code %s, want %s", code, codeInvalidArgs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("intArg(%#v): %v", tc.value, err)
+			}
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("intArg(%#v) = %d, %t; want %d, %t", tc.value, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestNumberArg(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		value   any
+		want    float64
+		wantErr bool
+	}{
+		{"int", 3, 3, false},
+		{"int32", int32(3), 3, false},
+		{"int64", int64(3), 3, false},
+		{"float64", 2.5, 2.5, false},
+		{"whole numeric string", "3", 3, false},
+		{"fractional numeric string", "2.5", 2.5, false},
+		{"non-numeric string", "abc", 0, true},
+		{"NaN string", "NaN", 0, true},
+		{"Inf string", "Inf", 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, err := numberArg(map[string]any{"n": tc.value}, "n")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("numberArg(%#v) = %g, want an error", tc.value, got)
+				}
+				return
+			}
+			if err != nil || !ok || got != tc.want {
+				t.Errorf("numberArg(%#v) = %g, %t, %v; want %g", tc.value, got, ok, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenamedArg(t *testing.T) {
+	args := map[string]any{"token": "1:T", "oldName": 3}
+	got, err := renamedArg(args, "newName", "oldName")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["newName"] != 3 || got["oldName"] != nil || got["token"] != "1:T" {
+		t.Errorf("renamedArg = %v, want oldName moved to newName", got)
+	}
+	if args["oldName"] != 3 || args["newName"] != nil {
+		t.Errorf("renamedArg changed its input to %v", args)
+	}
+
+	current := map[string]any{"newName": 1}
+	if got, err := renamedArg(current, "newName", "oldName"); err != nil || got["newName"] != 1 {
+		t.Errorf("renamedArg without the old name = %v, %v", got, err)
+	}
+
+	_, err = renamedArg(map[string]any{"newName": 1, "oldName": 2}, "newName", "oldName")
+	if code := errorCode(err); err == nil || code != codeInvalidArgs {
+		t.Errorf("renamedArg with both names: %v (%s), want %s", err, code, codeInvalidArgs)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// handleAnswerCallbackQuery acknowledges an inline keyboard button press so
+// the client stops showing its loading spinner, optionally displaying a
+// notification or alert to the user.
+func (t *TelegramPlugin) handleAnswerCallbackQuery(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	queryID, _ := args["callbackQueryID"].(string)
+	text, _ := args["text"].(string)
+	showAlert, hasShowAlert, err := boolArg(args, "showAlert")
+	if err != nil {
+		return fail(err)
+	}
+	cacheTime, hasCacheTime, err := intArg(args, "cacheTime")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || queryID == "" {
+		return invalidArgs("token and callbackQueryID are required")
+	}
+	if cacheTime < 0 {
+		return invalidArgs("cacheTime must not be negative")
+	}
+
+	form := url.Values{}
+	form.Set("callback_query_id", queryID)
+	if text != "" {
+		form.Set("text", text)
+	}
+	if hasShowAlert {
+		form.Set("show_alert", strconv.FormatBool(showAlert))
+	}
+	if hasCacheTime {
+		form.Set("cache_time", strconv.FormatInt(cacheTime, 10))
+	}
+
+	if err := callTelegram(ctx, token, "answerCallbackQuery", form, nil); err != nil {
+		return fail(err)
+	}
+	return succeed(nil)
+}
+
+// webhookSecretChars are the characters Telegram allows in a secret token.
+const webhookSecretChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-"
+
+// webhookSecretMatches compares a received X-Telegram-Bot-Api-Secret-Token
+// header with the secret given to SetWebhook in constant time. Both are
+// hashed first so the comparison does not leak the secret's length either.
+func webhookSecretMatches(provided, expected string) bool {
+	p := sha256.Sum256([]byte(provided))
+	e := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(p[:], e[:]) == 1
+}
+
+// handleVerifyWebhookSecret checks the secret header of a webhook request.
+func (t *TelegramPlugin) handleVerifyWebhookSecret(ctx context.Context, args map[string]any) sdk.Response {
+	provided, _ := args["providedSecret"].(string)
+	expected, _ := args["expectedSecret"].(string)
+	if expected == "" {
+		return invalidArgs("expectedSecret is required")
+	}
+	return succeed(map[string]any{"valid": webhookSecretMatches(provided, expected)})
+}
+
+// handleSetWebhook points the bot's updates at an HTTPS URL.
+func (t *TelegramPlugin) handleSetWebhook(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	hookURL, _ := args["url"].(string)
+	secret, _ := args["secretToken"].(string)
+	allowed, err := stringsArg(args, "allowedUpdates")
+	if err != nil {
+		return fail(err)
+	}
+	maxConns, hasMaxConns, err := intArg(args, "maxConnections")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || hookURL == "" {
+		return invalidArgs("token and url are required")
+	}
+	if u, err := url.Parse(hookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return invalidArgs("url must be an absolute https URL")
+	}
+	if secret != "" && (len(secret) > 256 || strings.Trim(secret, webhookSecretChars) != "") {
+		return invalidArgs("secretToken must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+	if hasMaxConns && (maxConns < 1 || maxConns > 100) {
+		return invalidArgs("maxConnections must be between 1 and 100")
+	}
+
+	form := url.Values{}
+	form.Set("url", hookURL)
+	if secret != "" {
+		form.Set("secret_token", secret)
+	}
+	if allowed != nil {
+		encoded, err := json.Marshal(allowed)
+		if err != nil {
+			return fail(err)
+		}
+		form.Set("allowed_updates", string(encoded))
+	}
+	if hasMaxConns {
+		form.Set("max_connections", strconv.FormatInt(maxConns, 10))
+	}
+
+	env, err := postTelegram(ctx, token, "setWebhook", form)
+	if err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"description": env.Description})
+}
+
+// handleDeleteWebhook removes the webhook so updates can be polled again.
+func (t *TelegramPlugin) handleDeleteWebhook(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	drop, hasDrop, err := boolArg(args, "dropPendingUpdates")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+
+	form := url.Values{}
+	if hasDrop {
+		form.Set("drop_pending_updates", strconv.FormatBool(drop))
+	}
+
+	env, err := postTelegram(ctx, token, "deleteWebhook", form)
+	if err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"description": env.Description})
+}
+
+// handleGetWebhookInfo reports the current webhook and its delivery state,
+// including the last error Telegram hit while delivering updates.
+func (t *TelegramPlugin) handleGetWebhookInfo(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+
+	var info struct {
+		URL                string   `json:"url"`
+		PendingUpdateCount int64    `json:"pending_update_count"`
+		LastErrorDate      int64    `json:"last_error_date"`
+		LastErrorMessage   string   `json:"last_error_message"`
+		MaxConnections     int64    `json:"max_connections"`
+		AllowedUpdates     []string `json:"allowed_updates"`
+	}
+	if err := callTelegram(ctx, token, "getWebhookInfo", url.Values{}, &info); err != nil {
+		return fail(err)
+	}
+
+	data := map[string]any{
+		"url":                info.URL,
+		"pendingUpdateCount": info.PendingUpdateCount,
+		"lastErrorMessage":   info.LastErrorMessage,
+		"lastErrorDate":      info.LastErrorDate,
+		"maxConnections":     info.MaxConnections,
+	}
+	if info.AllowedUpdates != nil {
+		data["allowedUpdates"] = info.AllowedUpdates
+	}
+	return succeed(data)
+}
+
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// commandScopeForm sets the optional scope and language_code shared by the
+// *MyCommands methods.
+func commandScopeForm(args map[string]any, form url.Values) error {
+	if scope, ok := args["scope"]; ok && scope != nil {
+		m, ok := scope.(map[string]any)
+		if !ok {
+			return argErrorf("scope must be an object")
+		}
+		if t, _ := m["type"].(string); t == "" {
+			return argErrorf("scope.type is required")
+		}
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		form.Set("scope", string(encoded))
+	}
+	if lang, _ := args["languageCode"].(string); lang != "" {
+		form.Set("language_code", lang)
+	}
+	return nil
+}
+
+// handleSetMyCommands sets the command menu users see when typing "/".
+func (t *TelegramPlugin) handleSetMyCommands(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	items, err := mapsArg(args, "commands")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || items == nil {
+		return invalidArgs("token and commands are required")
+	}
+	if len(items) > 100 {
+		return invalidArgs("at most 100 commands are allowed, got %d", len(items))
+	}
+
+	commands := make([]map[string]string, len(items))
+	for i, item := range items {
+		name, _ := item["command"].(string)
+		desc, _ := item["description"].(string)
+		if !commandNamePattern.MatchString(name) {
+			return invalidArgs("commands[%d]: command %q must be 1-32 lowercase letters, digits or underscores", i, name)
+		}
+		if n := utf8.RuneCountInString(desc); n < 1 || n > 256 {
+			return invalidArgs("commands[%d]: description must be 1-256 characters", i)
+		}
+		commands[i] = map[string]string{"command": name, "description": desc}
+	}
+	encoded, err := json.Marshal(commands)
+	if err != nil {
+		return fail(err)
+	}
+
+	form := url.Values{}
+	form.Set("commands", string(encoded))
+	if err := commandScopeForm(args, form); err != nil {
+		return fail(err)
+	}
+
+	if err := callTelegram(ctx, token, "setMyCommands", form, nil); err != nil {
+		return fail(err)
+	}
+	return succeed(nil)
+}
+
+// handleDeleteMyCommands clears the command menu for the given scope and
+// language, falling back to the next broader one.
+func (t *TelegramPlugin) handleDeleteMyCommands(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+
+	form := url.Values{}
+	if err := commandScopeForm(args, form); err != nil {
+		return fail(err)
+	}
+
+	if err := callTelegram(ctx, token, "deleteMyCommands", form, nil); err != nil {
+		return fail(err)
+	}
+	return succeed(nil)
+}
+
+// handleGetMyCommands returns the command menu for the given scope and
+// language.
+func (t *TelegramPlugin) handleGetMyCommands(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+
+	form := url.Values{}
+	if err := commandScopeForm(args, form); err != nil {
+		return fail(err)
+	}
+
+	var commands []struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+	if err := callTelegram(ctx, token, "getMyCommands", form, &commands); err != nil {
+		return fail(err)
+	}
+
+	out := make([]any, len(commands))
+	for i, c := range commands {
+		out[i] = map[string]any{"command": c.Command, "description": c.Description}
+	}
+	return succeed(map[string]any{"commands": out})
+}
+
+// handleGetMe returns the bot's identity, which makes it the natural check
+// that a token is valid.
+func (t *TelegramPlugin) handleGetMe(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+
+	var me struct {
+		ID                      int64  `json:"id"`
+		Username                string `json:"username"`
+		FirstName               string `json:"first_name"`
+		CanJoinGroups           bool   `json:"can_join_groups"`
+		CanReadAllGroupMessages bool   `json:"can_read_all_group_messages"`
+	}
+	if err := callTelegram(ctx, token, "getMe", url.Values{}, &me); err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && (apiErr.Code == 401 || apiErr.Code == 404) {
+			return fail(fmt.Errorf("invalid bot token: %w", err))
+		}
+		return fail(err)
+	}
+
+	return succeed(map[string]any{
+		"id":                      strconv.FormatInt(me.ID, 10),
+		"username":                me.Username,
+		"firstName":               me.FirstName,
+		"canJoinGroups":           me.CanJoinGroups,
+		"canReadAllGroupMessages": me.CanReadAllGroupMessages,
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestWebhookSecretMatches(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		provided, expected string
+		want               bool
+	}{
+		{"match", "s3cret_Token-1", "s3cret_Token-1", true},
+		{"missing", "", "s3cret_Token-1", false},
+		{"equal length mismatch", "s3cret_Token-2", "s3cret_Token-1", false},
+		{"shorter", "s3cret", "s3cret_Token-1", false},
+		{"longer", "s3cret_Token-1x", "s3cret_Token-1", false},
+		{"case differs", "S3CRET_TOKEN-1", "s3cret_Token-1", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := webhookSecretMatches(tc.provided, tc.expected); got != tc.want {
+				t.Errorf("webhookSecretMatches(%q, %q) = %v, want %v", tc.provided, tc.expected, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessUpdateSecret(t *testing.T) {
+	p := newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL))
+	update := map[string]any{"update_id": 1, "message": map[string]any{"message_id": 2, "chat": map[string]any{"id": 3}}}
+
+	for _, tc := range []struct {
+		name     string
+		secret   any // secretToken; nil leaves it out
+		expected any // expectedSecret; nil leaves it out
+		wantOK   bool
+	}{
+		{"no secret configured", nil, nil, true},
+		{"no secret configured, one sent", "whatever", nil, true},
+		{"right secret", "s3cret", "s3cret", true},
+		{"missing secret", nil, "s3cret", false},
+		{"wrong secret, same length", "s3creT", "s3cret", false},
+		{"wrong secret, other length", "s3cret-but-longer", "s3cret", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := map[string]any{"update": update}
+			if tc.secret != nil {
+				args["secretToken"] = tc.secret
+			}
+			if tc.expected != nil {
+				args["expectedSecret"] = tc.expected
+			}
+			res := callRaw(t, p, "ProcessUpdate", args)
+			if res.Success != tc.wantOK {
+				t.Fatalf("Success = %v (%s), want %v", res.Success, res.Error, tc.wantOK)
+			}
+			data, _ := res.Data.(map[string]any)
+			if !tc.wantOK {
+				if data["errorCode"] != codeUnverifiedUpdate {
+					t.Errorf("errorCode = %v, want %s", data["errorCode"], codeUnverifiedUpdate)
+				}
+				if data["type"] != nil {
+					t.Error("rejected update was normalized")
+				}
+			} else if data["type"] != "message" {
+				t.Errorf("type = %v, want message", data["type"])
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookSecret(t *testing.T) {
+	p := newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL))
+	if data := call(t, p, "VerifyWebhookSecret", map[string]any{"providedSecret": "abc", "expectedSecret": "abc"}); data["valid"] != true {
+		t.Errorf("valid = %v for the right secret", data["valid"])
+	}
+	if data := call(t, p, "VerifyWebhookSecret", map[string]any{"providedSecret": "abd", "expectedSecret": "abc"}); data["valid"] != false {
+		t.Errorf("valid = %v for the wrong secret", data["valid"])
+	}
+	res := callRaw(t, p, "VerifyWebhookSecret", map[string]any{"providedSecret": "abc"})
+	if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+		t.Errorf("no expectedSecret: Success=%v errorCode=%v, want INVALID_ARGS", res.Success, data["errorCode"])
+	}
+}
@@ -0,0 +1,824 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// permissionHints are fragments of Bot API error descriptions caused by the
+// bot lacking membership or admin rights rather than by a bad request.
+var permissionHints = []string{
+	"not enough rights",
+	"CHAT_ADMIN_REQUIRED",
+	"need administrator rights",
+	"bot is not a member",
+	"bot was kicked",
+	"have no rights",
+}
+
+// permissionError is a Bot API error caused by missing rights in the chat.
+type permissionError struct {
+	action string
+	err    *apiError
+}
+
+func (e *permissionError) Error() string {
+	if strings.Contains(e.err.Description, "not a member") || strings.Contains(e.err.Description, "kicked") {
+		return fmt.Sprintf("bot cannot %s: it is not a member of this chat: %s", e.action, e.err.Description)
+	}
+	return fmt.Sprintf("bot lacks permission to %s in this chat (make sure it is an admin with the required rights): %s", e.action, e.err.Description)
+}
+
+func (e *permissionError) Unwrap() error { return e.err }
+
+// explainPermission rewrites permission-related Bot API errors so callers
+// can tell a rights problem from a bug. Other errors are returned unchanged.
+func explainPermission(err error, action string) error {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	for _, hint := range permissionHints {
+		if strings.Contains(apiErr.Description, hint) {
+			return &permissionError{action: action, err: apiErr}
+		}
+	}
+	return err
+}
+
+// userIDArg reads a numeric Telegram user ID.
+func userIDArg(args map[string]any, key string) (string, error) {
+	id, err := idArg(args, key)
+	if err != nil || id == "" {
+		return id, err
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return "", argErrorf("%s must be numeric", key)
+	}
+	return id, nil
+}
+
+// handleBanChatMember bans a user from a group or channel, optionally only
+// until untilDate (a Unix timestamp) and deleting their messages.
+func (t *TelegramPlugin) handleBanChatMember(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	userID, err := userIDArg(args, "userID")
+	if err != nil {
+		return fail(err)
+	}
+	untilDate, hasUntil, err := intArg(args, "untilDate")
+	if err != nil {
+		return fail(err)
+	}
+	revoke, hasRevoke, err := boolArg(args, "revokeMessages")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || userID == "" {
+		return invalidArgs("token, chatID and userID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("user_id", userID)
+	if hasUntil {
+		form.Set("until_date", strconv.FormatInt(untilDate, 10))
+	}
+	if hasRevoke {
+		form.Set("revoke_messages", strconv.FormatBool(revoke))
+	}
+
+	if err := callTelegram(ctx, token, "banChatMember", form, nil); err != nil {
+		return fail(explainPermission(err, "ban members"))
+	}
+	return succeed(map[string]any{"banned": true})
+}
+
+// handleUnbanChatMember lifts a ban. With onlyIfBanned, users who are
+// currently members are left alone instead of being removed.
+func (t *TelegramPlugin) handleUnbanChatMember(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	userID, err := userIDArg(args, "userID")
+	if err != nil {
+		return fail(err)
+	}
+	onlyIfBanned, hasOnlyIfBanned, err := boolArg(args, "onlyIfBanned")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || userID == "" {
+		return invalidArgs("token, chatID and userID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("user_id", userID)
+	if hasOnlyIfBanned {
+		form.Set("only_if_banned", strconv.FormatBool(onlyIfBanned))
+	}
+
+	if err := callTelegram(ctx, token, "unbanChatMember", form, nil); err != nil {
+		return fail(explainPermission(err, "unban members"))
+	}
+	return succeed(map[string]any{"unbanned": true})
+}
+
+// handlePinChatMessage pins a message in a chat.
+func (t *TelegramPlugin) handlePinChatMessage(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	messageID, err := idArg(args, "messageID")
+	if err != nil {
+		return fail(err)
+	}
+	silent, hasSilent, err := boolArg(args, "disableNotification")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || messageID == "" {
+		return invalidArgs("token, chatID and messageID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("message_id", messageID)
+	if hasSilent {
+		form.Set("disable_notification", strconv.FormatBool(silent))
+	}
+
+	if err := callTelegram(ctx, token, "pinChatMessage", form, nil); err != nil {
+		return fail(explainPermission(err, "pin messages"))
+	}
+	return succeed(map[string]any{"pinned": true})
+}
+
+// handleUnpinChatMessage unpins messageID, or the most recently pinned
+// message when messageID is omitted.
+func (t *TelegramPlugin) handleUnpinChatMessage(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	messageID, err := idArg(args, "messageID")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	if messageID != "" {
+		form.Set("message_id", messageID)
+	}
+
+	if err := callTelegram(ctx, token, "unpinChatMessage", form, nil); err != nil {
+		return fail(explainPermission(err, "unpin messages"))
+	}
+	return succeed(map[string]any{"unpinned": true})
+}
+
+// handleGetChat returns Telegram's full Chat object (title, type,
+// description, permissions, ...) as-is.
+func (t *TelegramPlugin) handleGetChat(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+
+	var chat map[string]any
+	if err := callTelegram(ctx, token, "getChat", form, &chat); err != nil {
+		return fail(explainPermission(err, "read chat details"))
+	}
+	return succeed(chat)
+}
+
+// handleGetChatMemberCount returns the number of members in a chat.
+func (t *TelegramPlugin) handleGetChatMemberCount(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+
+	var count int64
+	if err := callTelegram(ctx, token, "getChatMemberCount", form, &count); err != nil {
+		return fail(explainPermission(err, "count chat members"))
+	}
+	return succeed(map[string]any{"count": count})
+}
+
+// handleGetChatAdministrators lists a chat's administrators with their
+// status and the rights they were granted, so workflows can check rights
+// before a moderation call instead of having it fail.
+func (t *TelegramPlugin) handleGetChatAdministrators(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+
+	var members []map[string]any
+	if err := callTelegram(ctx, token, "getChatAdministrators", form, &members); err != nil {
+		return fail(explainPermission(err, "list chat administrators"))
+	}
+	admins := make([]any, len(members))
+	for i, m := range members {
+		admins[i] = chatMemberInfo(m)
+	}
+	return succeed(map[string]any{"administrators": admins, "count": len(admins)})
+}
+
+// handleIsChatAdmin reports whether a user, by default the bot itself, is
+// an administrator or the creator of a chat.
+func (t *TelegramPlugin) handleIsChatAdmin(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	userID, err := userIDArg(args, "userID")
+	if err != nil {
+		return fail(err)
+	}
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+	if userID == "" {
+		// A bot's user ID is the part of its token before the colon.
+		if userID = botID(token); strings.HasPrefix(userID, "sha256:") {
+			return invalidArgs("userID is required: the bot's ID cannot be read from this token")
+		}
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("user_id", userID)
+
+	var member map[string]any
+	if err := callTelegram(ctx, token, "getChatMember", form, &member); err != nil {
+		return fail(explainPermission(err, "read chat members"))
+	}
+	info := chatMemberInfo(member)
+	status, _ := info["status"].(string)
+	info["isAdmin"] = status == "creator" || status == "administrator"
+	return succeed(info)
+}
+
+// chatMemberInfo flattens a ChatMember. permissions lists the can_* rights
+// that are granted; a creator has every right, which Telegram does not
+// list.
+func chatMemberInfo(m map[string]any) map[string]any {
+	info := map[string]any{"status": stringField(m, "status")}
+	setField(info, "userID", idField(m, "user", "id"))
+	setField(info, "username", stringField(m, "user", "username"))
+	setField(info, "firstName", stringField(m, "user", "first_name"))
+	setField(info, "customTitle", stringField(m, "custom_title"))
+	isBot, _ := lookup(m, "user", "is_bot").(bool)
+	info["isBot"] = isBot
+	anonymous, _ := m["is_anonymous"].(bool)
+	info["isAnonymous"] = anonymous
+
+	permissions := []string{}
+	for key, v := range m {
+		if granted, _ := v.(bool); granted && strings.HasPrefix(key, "can_") {
+			permissions = append(permissions, key)
+		}
+	}
+	sort.Strings(permissions)
+	info["permissions"] = permissions
+	return info
+}
+
+// chatPermissions are the ChatPermissions fields RestrictChatMember accepts.
+var chatPermissions = map[string]bool{
+	"can_send_messages":         true,
+	"can_send_audios":           true,
+	"can_send_documents":        true,
+	"can_send_photos":           true,
+	"can_send_videos":           true,
+	"can_send_video_notes":      true,
+	"can_send_voice_notes":      true,
+	"can_send_polls":            true,
+	"can_send_other_messages":   true,
+	"can_add_web_page_previews": true,
+	"can_change_info":           true,
+	"can_invite_users":          true,
+	"can_pin_messages":          true,
+	"can_manage_topics":         true,
+}
+
+// mediaPermissions replace the can_send_media_messages flag older Bot API
+// versions had; callers may still send it and it is expanded to these.
+var mediaPermissions = []string{
+	"can_send_audios",
+	"can_send_documents",
+	"can_send_photos",
+	"can_send_videos",
+	"can_send_video_notes",
+	"can_send_voice_notes",
+}
+
+// handleRestrictChatMember changes what a supergroup member may do, e.g.
+// muting them until untilDate (a Unix timestamp) by revoking
+// can_send_messages.
+func (t *TelegramPlugin) handleRestrictChatMember(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	userID, err := userIDArg(args, "userID")
+	if err != nil {
+		return fail(err)
+	}
+	perms, _ := args["permissions"].(map[string]any)
+	untilDate, hasUntil, err := intArg(args, "untilDate")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || userID == "" || perms == nil {
+		return invalidArgs("token, chatID, userID and permissions are required")
+	}
+	if hasUntil && untilDate <= time.Now().Unix() {
+		return invalidArgs("untilDate must be in the future")
+	}
+
+	permissions := make(map[string]bool, len(perms))
+	for key, v := range perms {
+		allowed, ok := v.(bool)
+		if !ok {
+			return invalidArgs("permissions.%s must be a boolean", key)
+		}
+		if key == "can_send_media_messages" {
+			continue
+		}
+		if !chatPermissions[key] {
+			return invalidArgs("unknown permission %q", key)
+		}
+		permissions[key] = allowed
+	}
+	if media, ok := perms["can_send_media_messages"].(bool); ok {
+		for _, key := range mediaPermissions {
+			if _, set := permissions[key]; !set {
+				permissions[key] = media
+			}
+		}
+	}
+	encoded, err := json.Marshal(permissions)
+	if err != nil {
+		return fail(err)
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("user_id", userID)
+	form.Set("permissions", string(encoded))
+	if hasUntil {
+		form.Set("until_date", strconv.FormatInt(untilDate, 10))
+	}
+
+	if err := callTelegram(ctx, token, "restrictChatMember", form, nil); err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && (strings.Contains(apiErr.Description, "is an administrator") || strings.Contains(apiErr.Description, "chat owner")) {
+			return fail(fmt.Errorf("cannot restrict a chat administrator or the owner; demote them first: %w", err))
+		}
+		return fail(explainPermission(err, "restrict members"))
+	}
+	return succeed(nil)
+}
+
+// handleExportChatInviteLink replaces the chat's primary invite link with a
+// new one and returns it. Links exported earlier stop working.
+func (t *TelegramPlugin) handleExportChatInviteLink(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+
+	var link string
+	if err := callTelegram(ctx, token, "exportChatInviteLink", form, &link); err != nil {
+		return fail(explainPermission(err, "manage invite links"))
+	}
+	return succeed(map[string]any{"inviteLink": link})
+}
+
+// handleCreateChatInviteLink creates an additional invite link that can be
+// named, limited in time or members, and revoked on its own.
+func (t *TelegramPlugin) handleCreateChatInviteLink(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	name, _ := args["name"].(string)
+	expireDate, hasExpire, err := intArg(args, "expireDate")
+	if err != nil {
+		return fail(err)
+	}
+	memberLimit, hasLimit, err := intArg(args, "memberLimit")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+	if utf16Len(name) > 32 {
+		return invalidArgs("name must be at most 32 characters")
+	}
+	if hasExpire && expireDate <= time.Now().Unix() {
+		return invalidArgs("expireDate must be in the future")
+	}
+	if hasLimit && (memberLimit < 1 || memberLimit > 99999) {
+		return invalidArgs("memberLimit must be between 1 and 99999")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	if name != "" {
+		form.Set("name", name)
+	}
+	if hasExpire {
+		form.Set("expire_date", strconv.FormatInt(expireDate, 10))
+	}
+	if hasLimit {
+		form.Set("member_limit", strconv.FormatInt(memberLimit, 10))
+	}
+
+	var link struct {
+		InviteLink string `json:"invite_link"`
+		Name       string `json:"name"`
+		ExpireDate int64  `json:"expire_date"`
+	}
+	if err := callTelegram(ctx, token, "createChatInviteLink", form, &link); err != nil {
+		return fail(explainPermission(err, "manage invite links"))
+	}
+	data := map[string]any{"inviteLink": link.InviteLink}
+	if link.Name != "" {
+		data["name"] = link.Name
+	}
+	if link.ExpireDate != 0 {
+		data["expireDate"] = link.ExpireDate
+	}
+	return succeed(data)
+}
+
+// handleLeaveChat makes the bot leave a group, supergroup or channel.
+func (t *TelegramPlugin) handleLeaveChat(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+
+	if err := callTelegram(ctx, token, "leaveChat", form, nil); err != nil {
+		return fail(explainPermission(err, "leave the chat"))
+	}
+	return succeed(map[string]any{"left": true})
+}
+
+// forumIconColors are the only iconColor values createForumTopic accepts.
+var forumIconColors = map[int64]bool{
+	0x6FB9F0: true,
+	0xFFD67E: true,
+	0xCB86DB: true,
+	0x8EEE98: true,
+	0xFF93B2: true,
+	0xFB6F5F: true,
+}
+
+// handleCreateForumTopic creates a topic in a forum supergroup. The
+// messageThreadID it returns is what SendMessage and the other forum topic
+// methods take.
+func (t *TelegramPlugin) handleCreateForumTopic(ctx context.Context, args map[string]any) sdk.Response {
+	args, err := renamedArg(args, "iconCustomEmojiID", "iconCustomEmojiId")
+	if err != nil {
+		return fail(err)
+	}
+	topic, err := createForumTopic(ctx, args)
+	if err != nil {
+		return fail(err)
+	}
+	data := map[string]any{
+		"messageThreadID": strconv.FormatInt(topic.MessageThreadID, 10),
+		"name":            topic.Name,
+		"iconColor":       topic.IconColor,
+	}
+	if topic.IconCustomEmojiID != "" {
+		data["iconCustomEmojiID"] = topic.IconCustomEmojiID
+	}
+	return succeed(data)
+}
+
+// forumTopic is the ForumTopic createForumTopic returns.
+type forumTopic struct {
+	MessageThreadID   int64  `json:"message_thread_id"`
+	Name              string `json:"name"`
+	IconColor         int64  `json:"icon_color"`
+	IconCustomEmojiID string `json:"icon_custom_emoji_id"`
+}
+
+// createForumTopic creates the topic named by args["name"], with the icon
+// from iconColor and iconCustomEmojiID.
+func createForumTopic(ctx context.Context, args map[string]any) (forumTopic, error) {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	name, _ := args["name"].(string)
+	emojiID, _ := args["iconCustomEmojiID"].(string)
+	color, hasColor, err := intArg(args, "iconColor")
+	if err != nil {
+		return forumTopic{}, err
+	}
+
+	if token == "" || chatID == "" || name == "" {
+		return forumTopic{}, argErrorf("token, chatID and name are required")
+	}
+	if utf16Len(name) > 128 {
+		return forumTopic{}, argErrorf("name must be at most 128 characters")
+	}
+	if hasColor && !forumIconColors[color] {
+		return forumTopic{}, argErrorf("iconColor must be one of 7322096, 16766590, 13338331, 9367192, 16749490 or 16478047")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("name", name)
+	if hasColor {
+		form.Set("icon_color", strconv.FormatInt(color, 10))
+	}
+	if emojiID != "" {
+		form.Set("icon_custom_emoji_id", emojiID)
+	}
+
+	var topic forumTopic
+	if err := callTelegram(ctx, token, "createForumTopic", form, &topic); err != nil {
+		return forumTopic{}, explainPermission(err, "manage topics")
+	}
+	return topic, nil
+}
+
+// handleEditForumTopic renames a topic or changes its icon. An empty
+// iconCustomEmojiID removes the icon; omitting it keeps the current one.
+func (t *TelegramPlugin) handleEditForumTopic(ctx context.Context, args map[string]any) sdk.Response {
+	args, err := renamedArg(args, "iconCustomEmojiID", "iconCustomEmojiId")
+	if err != nil {
+		return fail(err)
+	}
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	threadID, err := idArg(args, "messageThreadID")
+	if err != nil {
+		return fail(err)
+	}
+	name, _ := args["name"].(string)
+	emojiID, hasEmoji := args["iconCustomEmojiID"].(string)
+
+	if token == "" || chatID == "" || threadID == "" {
+		return invalidArgs("token, chatID and messageThreadID are required")
+	}
+	if name == "" && !hasEmoji {
+		return invalidArgs("name or iconCustomEmojiID is required")
+	}
+	if utf16Len(name) > 128 {
+		return invalidArgs("name must be at most 128 characters")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("message_thread_id", threadID)
+	if name != "" {
+		form.Set("name", name)
+	}
+	if hasEmoji {
+		form.Set("icon_custom_emoji_id", emojiID)
+	}
+
+	if err := callTelegram(ctx, token, "editForumTopic", form, nil); err != nil {
+		return fail(explainPermission(err, "manage topics"))
+	}
+	return succeed(map[string]any{"edited": true})
+}
+
+// handleCloseForumTopic closes a topic to new messages from members.
+func (t *TelegramPlugin) handleCloseForumTopic(ctx context.Context, args map[string]any) sdk.Response {
+	return forumTopicAction(ctx, args, "closeForumTopic", "closed")
+}
+
+// handleReopenForumTopic reopens a closed topic.
+func (t *TelegramPlugin) handleReopenForumTopic(ctx context.Context, args map[string]any) sdk.Response {
+	return forumTopicAction(ctx, args, "reopenForumTopic", "reopened")
+}
+
+// forumTopicAction calls a Bot API method that takes only a chat and a
+// topic, reporting result=true on success.
+func forumTopicAction(ctx context.Context, args map[string]any, method, result string) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	threadID, err := idArg(args, "messageThreadID")
+	if err != nil {
+		return fail(err)
+	}
+	if token == "" || chatID == "" || threadID == "" {
+		return invalidArgs("token, chatID and messageThreadID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("message_thread_id", threadID)
+
+	if err := callTelegram(ctx, token, method, form, nil); err != nil {
+		return fail(explainPermission(err, "manage topics"))
+	}
+	return succeed(map[string]any{result: true})
+}
+
+// handleSendToTopic sends a message into the forum topic named topicName,
+// creating the topic the first time the name is used. Thread IDs are
+// cached by chat and name for the life of the process, and a cached topic
+// Telegram no longer knows is created again. The message itself is sent as
+// SendMessage would send it.
+func (t *TelegramPlugin) handleSendToTopic(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	name, _ := args["topicName"].(string)
+	if token == "" || chatID == "" || name == "" {
+		return invalidArgs("token, chatID and topicName are required")
+	}
+	if text, _ := args["text"].(string); text == "" {
+		return invalidArgs("text is required")
+	}
+
+	topicArgs := map[string]any{"token": token, "chatID": chatID, "name": name}
+	for _, k := range []string{"iconColor", "iconCustomEmojiID"} {
+		if v, ok := args[k]; ok {
+			topicArgs[k] = v
+		}
+	}
+	create := func(ctx context.Context) (int64, error) {
+		topic, err := createForumTopic(ctx, topicArgs)
+		return topic.MessageThreadID, err
+	}
+
+	sendArgs := make(map[string]any, len(args))
+	for k, v := range args {
+		sendArgs[k] = v
+	}
+	for _, k := range []string{"topicName", "iconColor", "iconCustomEmojiID"} {
+		delete(sendArgs, k)
+	}
+
+	for attempt := 0; ; attempt++ {
+		threadID, created, err := t.state.topics.get(ctx, chatID, name, create)
+		if err != nil {
+			return fail(err)
+		}
+		sendArgs["messageThreadID"] = threadID
+		res := t.handleSendMessage(ctx, sendArgs)
+		if !res.Success && attempt == 0 && !created && strings.Contains(res.Error, "message thread not found") {
+			t.state.topics.forget(chatID, name, threadID)
+			continue
+		}
+		if data, ok := res.Data.(map[string]any); ok {
+			data["messageThreadID"] = strconv.FormatInt(threadID, 10)
+			data["topicCreated"] = created
+		}
+		return res
+	}
+}
+
+// topicCache remembers the thread IDs of SendToTopic topics, by chat and
+// topic name.
+type topicCache struct {
+	mu     sync.Mutex
+	topics map[string]*cachedTopic
+}
+
+// cachedTopic is one topic name. Its mutex is held while the topic is
+// created, so concurrent calls for a new name create it only once.
+type cachedTopic struct {
+	mu       sync.Mutex
+	threadID int64
+}
+
+func newTopicCache() *topicCache {
+	return &topicCache{topics: map[string]*cachedTopic{}}
+}
+
+func topicKey(chatID, name string) string {
+	return normalizeChat(chatID) + "\x00" + name
+}
+
+// get returns the thread ID of chatID's topic name, calling create to make
+// it if there is none yet. created reports whether this call created it.
+func (c *topicCache) get(ctx context.Context, chatID, name string, create func(context.Context) (int64, error)) (threadID int64, created bool, err error) {
+	key := topicKey(chatID, name)
+	c.mu.Lock()
+	topic, ok := c.topics[key]
+	if !ok {
+		topic = &cachedTopic{}
+		c.topics[key] = topic
+	}
+	c.mu.Unlock()
+
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	if topic.threadID != 0 {
+		return topic.threadID, false, nil
+	}
+	id, err := create(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	topic.threadID = id
+	return id, true, nil
+}
+
+// forget drops a cached thread ID that no longer works, unless another
+// call has already replaced it.
+func (c *topicCache) forget(chatID, name string, threadID int64) {
+	c.mu.Lock()
+	topic := c.topics[topicKey(chatID, name)]
+	c.mu.Unlock()
+	if topic == nil {
+		return
+	}
+	topic.mu.Lock()
+	defer topic.mu.Unlock()
+	if topic.threadID == threadID {
+		topic.threadID = 0
+	}
+}
+
+// chatCache remembers the numeric ID of @username chats that Telegram
+// failed to find by username, for the life of the process.
+type chatCache struct {
+	mu  sync.Mutex
+	ids map[string]string // lowercased @username to chat ID
+}
+
+func newChatCache() *chatCache {
+	return &chatCache{ids: map[string]string{}}
+}
+
+// lookup returns the cached numeric ID for chatID, or chatID itself.
+func (c *chatCache) lookup(chatID string) string {
+	if !strings.HasPrefix(chatID, "@") {
+		return chatID
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[strings.ToLower(chatID)]; ok {
+		return id
+	}
+	return chatID
+}
+
+// resolve looks an @username up with getChat and caches its numeric ID.
+func (c *chatCache) resolve(ctx context.Context, token, username string) (string, error) {
+	form := url.Values{}
+	form.Set("chat_id", username)
+	var chat struct {
+		ID int64 `json:"id"`
+	}
+	if err := callTelegram(ctx, token, "getChat", form, &chat); err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(chat.ID, 10)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids[strings.ToLower(username)] = id
+	return id, nil
+}
+
+// chatNotFound reports whether Telegram could not find the target chat.
+func chatNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Code == 400 &&
+		strings.Contains(apiErr.Description, "chat not found")
+}
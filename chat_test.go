@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendMessageResolvesUsername(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	stub.usernames.Store("@Private", "-100123")
+
+	data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "@Private", "text": "hi"})
+	if data["resolvedChatID"] != "-100123" {
+		t.Errorf("resolvedChatID = %v, want -100123", data["resolvedChatID"])
+	}
+	if got := len(stub.sentTexts("-100123")); got != 1 {
+		t.Errorf("%d messages sent to the resolved ID, want 1", got)
+	}
+
+	// The cached ID is used from the start, whatever the username's case.
+	data = call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "@private", "text": "again"})
+	if data["resolvedChatID"] != "-100123" {
+		t.Errorf("resolvedChatID = %v on a cache hit", data["resolvedChatID"])
+	}
+	if got := stub.count("getChat"); got != 1 {
+		t.Errorf("getChat called %d times, want 1", got)
+	}
+	if got := stub.count("sendMessage"); got != 3 {
+		t.Errorf("sendMessage called %d times, want 3", got)
+	}
+}
+
+func TestSendMessageUnresolvableUsername(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	stub.usernames.Store("@ghost", "")
+
+	res := callRaw(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "@ghost", "text": "hi"})
+	data, _ := res.Data.(map[string]any)
+	if res.Success || data["errorCode"] != codeUpstreamBadRequest || !strings.Contains(res.Error, "chat not found") {
+		t.Errorf("Success=%v errorCode=%v error=%q; want the chat not found error", res.Success, data["errorCode"], res.Error)
+	}
+	if got := p.state.chats.lookup("@ghost"); got != "@ghost" {
+		t.Errorf("failed lookup cached as %s", got)
+	}
+	if got := stub.count("getChat"); got != 1 {
+		t.Errorf("getChat called %d times, want 1", got)
+	}
+}
+
+// Numeric IDs and found usernames are never looked up.
+func TestSendMessageSkipsResolve(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "-100456", "text": "hi"})
+	data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "@public", "text": "hi"})
+	if data["resolvedChatID"] != nil {
+		t.Errorf("resolvedChatID = %v for a found username", data["resolvedChatID"])
+	}
+	if got := stub.count("getChat"); got != 0 {
+		t.Errorf("getChat called %d times, want 0", got)
+	}
+}
+
+func TestForumTopicIconCustomEmojiID(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+
+	for _, name := range []string{"iconCustomEmojiID", "iconCustomEmojiId"} {
+		t.Run(name, func(t *testing.T) {
+			data := call(t, p, "CreateForumTopic", map[string]any{"token": "1:T", "chatID": "-100", "name": "Support", name: "5"})
+			if data["iconCustomEmojiID"] != "5" {
+				t.Errorf("CreateForumTopic iconCustomEmojiID = %v, want 5", data["iconCustomEmojiID"])
+			}
+
+			call(t, p, "EditForumTopic", map[string]any{"token": "1:T", "chatID": "-100", "messageThreadID": "1", name: "6"})
+			if got := stub.lastForm("editForumTopic").Get("icon_custom_emoji_id"); got != "6" {
+				t.Errorf("editForumTopic icon_custom_emoji_id = %q, want 6", got)
+			}
+		})
+	}
+
+	for _, method := range []string{"CreateForumTopic", "EditForumTopic"} {
+		res := callRaw(t, p, method, map[string]any{
+			"token": "1:T", "chatID": "-100", "name": "Support", "messageThreadID": "1",
+			"iconCustomEmojiID": "5", "iconCustomEmojiId": "6",
+		})
+		if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+			t.Errorf("%s with both spellings = %v, %v; want %s", method, res.Success, res.Data, codeInvalidArgs)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package client is a typed Go client for the Orka Telegram plugin. It
+// builds the sdk.Request for each method, calls the plugin over net/rpc and
+// turns the sdk.Response into a result struct or an *Error, so callers do
+// not hand-build argument maps or type-assert res.Data.
+//
+//	c, err := client.Dial("tcp", "127.0.0.1:50051")
+//	if err != nil { ... }
+//	defer c.Close()
+//	res, err := c.SendMessage(ctx, client.SendMessageParams{Token: token, ChatID: chatID, Text: "hi"})
+package client
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/rpc"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+func init() {
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register(map[string]string{})
+	gob.Register([]string{})
+}
+
+// serviceMethod is the RPC name the plugin registers.
+const serviceMethod = "TelegramPlugin.CallMethod"
+
+// Error is a call the plugin answered with Success false.
+type Error struct {
+	Method string
+	// Code is the plugin's errorCode, e.g. INVALID_ARGS or UPSTREAM_RATE_LIMIT.
+	Code    string
+	Message string
+	// RetryAfter is the number of seconds Telegram asked to wait, for
+	// UPSTREAM_RATE_LIMIT errors.
+	RetryAfter int64
+	// Data is the full response data, for fields not modelled above.
+	Data map[string]any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s failed (%s): %s", e.Method, e.Code, e.Message)
+}
+
+// Client calls one plugin process. It is safe for concurrent use.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to a plugin listening on network ("tcp" or "unix") and addr.
+func Dial(network, addr string) (*Client, error) {
+	c, err := rpc.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: c}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// Call invokes any plugin method with raw arguments and returns its data.
+// The typed methods below are built on it. If ctx ends first, Call returns
+// ctx.Err(); the plugin may still complete the call.
+func (c *Client) Call(ctx context.Context, method string, args map[string]any) (map[string]any, error) {
+	var res sdk.Response
+	call := c.rpc.Go(serviceMethod, sdk.Request{Method: method, Args: args}, &res, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.Done:
+	}
+	if call.Error != nil {
+		return nil, call.Error
+	}
+
+	data, _ := res.Data.(map[string]any)
+	if !res.Success {
+		e := &Error{Method: method, Message: res.Error, Data: data}
+		e.Code, _ = data["errorCode"].(string)
+		e.RetryAfter = toInt(data["retryAfter"])
+		return nil, e
+	}
+	return data, nil
+}
+
+// SendMessageParams are the arguments of SendMessage. Zero values are left
+// out of the request.
+type SendMessageParams struct {
+	Token  string
+	ChatID string
+	Text   string
+
+	ParseMode             string
+	FormatMarkdown        bool
+	ReplyToMessageID      int64
+	MessageThreadID       int64
+	DisableNotification   bool
+	DisableWebPagePreview bool
+	LinkPreviewOptions    map[string]any
+	AutoSplit             bool
+	IdempotencyKey        string
+	ScheduleAt            string
+	ConfirmDelivery       bool
+	ProtectContent        bool
+	MessageEffectID       string
+	RequestID             string
+	CorrelationID         string
+}
+
+// SendMessageResult is what SendMessage reports for a single chat.
+type SendMessageResult struct {
+	MessageID    string
+	MessageIDs   []string
+	Deduplicated bool
+	ScheduledID  string
+	// Spooled reports that a transient failure left the message, or the
+	// parts of it not yet sent, in the spool under SpoolID for a later
+	// FlushSpool.
+	Spooled       bool
+	SpoolID       string
+	FormattedText string
+	// SentAt and Link are only set with ConfirmDelivery.
+	SentAt        string
+	Link          string
+	RequestID     string
+	CorrelationID string
+}
+
+// SendMessage sends a text message to one chat.
+func (c *Client) SendMessage(ctx context.Context, p SendMessageParams) (SendMessageResult, error) {
+	args := map[string]any{"token": p.Token, "chatID": p.ChatID, "text": p.Text}
+	setString(args, "parseMode", p.ParseMode)
+	setBool(args, "formatMarkdown", p.FormatMarkdown)
+	setInt(args, "replyToMessageID", p.ReplyToMessageID)
+	setInt(args, "messageThreadID", p.MessageThreadID)
+	setBool(args, "disableNotification", p.DisableNotification)
+	setBool(args, "disableWebPagePreview", p.DisableWebPagePreview)
+	if p.LinkPreviewOptions != nil {
+		args["linkPreviewOptions"] = p.LinkPreviewOptions
+	}
+	setBool(args, "autoSplit", p.AutoSplit)
+	setString(args, "idempotencyKey", p.IdempotencyKey)
+	setString(args, "scheduleAt", p.ScheduleAt)
+	setBool(args, "confirmDelivery", p.ConfirmDelivery)
+	setBool(args, "protectContent", p.ProtectContent)
+	setString(args, "messageEffectID", p.MessageEffectID)
+	setString(args, "requestID", p.RequestID)
+	setString(args, "_correlationID", p.CorrelationID)
+
+	data, err := c.Call(ctx, "SendMessage", args)
+	if err != nil {
+		return SendMessageResult{}, err
+	}
+	res := SendMessageResult{
+		MessageIDs:   toStrings(data["messageIDs"]),
+		Deduplicated: data["deduplicated"] == true,
+		Spooled:      data["spooled"] == true,
+	}
+	res.MessageID, _ = data["messageID"].(string)
+	res.ScheduledID, _ = data["scheduledID"].(string)
+	res.SpoolID, _ = data["spoolID"].(string)
+	res.FormattedText, _ = data["formattedText"].(string)
+	res.SentAt, _ = data["sentAt"].(string)
+	res.Link, _ = data["link"].(string)
+	res.RequestID, _ = data["requestID"].(string)
+	res.CorrelationID, _ = data["correlationID"].(string)
+	return res, nil
+}
+
+// Bot is the identity GetMe reports.
+type Bot struct {
+	ID                      string
+	Username                string
+	FirstName               string
+	CanJoinGroups           bool
+	CanReadAllGroupMessages bool
+}
+
+// GetMe checks token and returns the bot it belongs to.
+func (c *Client) GetMe(ctx context.Context, token string) (Bot, error) {
+	data, err := c.Call(ctx, "GetMe", map[string]any{"token": token})
+	if err != nil {
+		return Bot{}, err
+	}
+	bot := Bot{
+		CanJoinGroups:           data["canJoinGroups"] == true,
+		CanReadAllGroupMessages: data["canReadAllGroupMessages"] == true,
+	}
+	bot.ID, _ = data["id"].(string)
+	bot.Username, _ = data["username"].(string)
+	bot.FirstName, _ = data["firstName"].(string)
+	return bot, nil
+}
+
+func setString(args map[string]any, key, v string) {
+	if v != "" {
+		args[key] = v
+	}
+}
+
+func setBool(args map[string]any, key string, v bool) {
+	if v {
+		args[key] = v
+	}
+}
+
+func setInt(args map[string]any, key string, v int64) {
+	if v != 0 {
+		args[key] = v
+	}
+}
+
+func toInt(v any) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func toStrings(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
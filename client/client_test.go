@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// fakePlugin stands in for the plugin's RPC service. It records the
+// requests it gets and answers each method with a canned response.
+type fakePlugin struct {
+	mu        sync.Mutex
+	requests  []sdk.Request
+	responses map[string]sdk.Response
+}
+
+func (f *fakePlugin) CallMethod(req sdk.Request, res *sdk.Response) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	*res = f.responses[req.Method]
+	return nil
+}
+
+// lastArgs returns the arguments of the latest request.
+func (f *fakePlugin) lastArgs() map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return nil
+	}
+	return f.requests[len(f.requests)-1].Args
+}
+
+// newTestClient serves fake on an in-process rpc.Server under the plugin's
+// service name and returns a Client connected to it.
+func newTestClient(t *testing.T, fake *fakePlugin) *Client {
+	t.Helper()
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("TelegramPlugin", fake); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go srv.ServeConn(serverConn)
+
+	c := &Client{rpc: rpc.NewClient(clientConn)}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSendMessage(t *testing.T) {
+	fake := &fakePlugin{responses: map[string]sdk.Response{
+		"SendMessage": {Success: true, Data: map[string]any{
+			"messageID": "7", "messageIDs": []string{"7", "8"}, "requestID": "r-1",
+		}},
+	}}
+	c := newTestClient(t, fake)
+
+	res, err := c.SendMessage(context.Background(), SendMessageParams{
+		Token: "1:T", ChatID: "42", Text: "hi", AutoSplit: true, RequestID: "r-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SendMessageResult{MessageID: "7", MessageIDs: []string{"7", "8"}, RequestID: "r-1"}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("SendMessage = %+v, want %+v", res, want)
+	}
+
+	wantArgs := map[string]any{"token": "1:T", "chatID": "42", "text": "hi", "autoSplit": true, "requestID": "r-1"}
+	if args := fake.lastArgs(); !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestSendMessageSpooled(t *testing.T) {
+	fake := &fakePlugin{responses: map[string]sdk.Response{
+		"SendMessage": {Success: true, Data: map[string]any{"spooled": true, "spoolID": "abc"}},
+	}}
+	c := newTestClient(t, fake)
+
+	res, err := c.SendMessage(context.Background(), SendMessageParams{Token: "1:T", ChatID: "42", Text: "hi", IdempotencyKey: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Spooled || res.SpoolID != "abc" {
+		t.Errorf("Spooled, SpoolID = %v, %q, want true, %q", res.Spooled, res.SpoolID, "abc")
+	}
+}
+
+func TestSendMessageError(t *testing.T) {
+	fake := &fakePlugin{responses: map[string]sdk.Response{
+		"SendMessage": {Error: "Too Many Requests", Data: map[string]any{"errorCode": "UPSTREAM_RATE_LIMIT", "retryAfter": int64(7)}},
+	}}
+	c := newTestClient(t, fake)
+
+	_, err := c.SendMessage(context.Background(), SendMessageParams{Token: "1:T", ChatID: "42", Text: "hi"})
+	var callErr *Error
+	if !errors.As(err, &callErr) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+	if callErr.Method != "SendMessage" || callErr.Code != "UPSTREAM_RATE_LIMIT" || callErr.RetryAfter != 7 || callErr.Message != "Too Many Requests" {
+		t.Errorf("err = %+v", callErr)
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	fake := &fakePlugin{responses: map[string]sdk.Response{
+		"GetMe": {Success: true, Data: map[string]any{
+			"id": "123", "username": "orka_bot", "firstName": "Orka", "canJoinGroups": true,
+		}},
+	}}
+	c := newTestClient(t, fake)
+
+	bot, err := c.GetMe(context.Background(), "1:T")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Bot{ID: "123", Username: "orka_bot", FirstName: "Orka", CanJoinGroups: true}
+	if bot != want {
+		t.Errorf("GetMe = %+v, want %+v", bot, want)
+	}
+	if args := fake.lastArgs(); !reflect.DeepEqual(args, map[string]any{"token": "1:T"}) {
+		t.Errorf("args = %v", args)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyConfigFile sets flags from a YAML or JSON file whose keys are flag
+// names, e.g. {"port": 50051, "allowed-chats": ["@alerts"]}. Lists are
+// joined with commas. Flags given on the command line keep their values.
+// Errors name the file and line of the offending key.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: config must be a mapping of flag names to values", path, root.Line)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		name := key.Value
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown key %q", path, key.Line, name)
+		}
+		// These act on the command line only, before the file is read.
+		if name == "config" || name == "version" {
+			return fmt.Errorf("%s:%d: %s cannot be set in a config file", path, key.Line, name)
+		}
+		value, err := configValue(node)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, node.Line, name, err)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value %q for %s: %w", path, node.Line, value, name, err)
+		}
+	}
+	return nil
+}
+
+// configValue renders a scalar or a list of scalars as a flag value.
+func configValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("list items must be plain values")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("must be a value or a list of values")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags mirrors a few of main's flags on their own FlagSet.
+func testFlags(args ...string) (*flag.FlagSet, map[string]*string, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	values := map[string]*string{
+		"log-level":     fs.String("log-level", "info", ""),
+		"allowed-chats": fs.String("allowed-chats", "", ""),
+		"config":        fs.String("config", "", ""),
+	}
+	fs.Int("port", 0, "")
+	fs.Bool("strict-args", false, "")
+	fs.Bool("version", false, "")
+	return fs, values, fs.Parse(args)
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, content string
+	}{
+		{"yaml", "plugin.yaml", "log-level: debug\nport: 50051\nstrict-args: true\nallowed-chats:\n  - \"-100123\"\n  - \"@alerts\"\n"},
+		{"json", "plugin.json", `{"log-level": "debug", "port": 50051, "strict-args": true, "allowed-chats": ["-100123", "@alerts"]}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, values, _ := testFlags()
+			if err := applyConfigFile(fs, writeConfig(t, tc.file, tc.content)); err != nil {
+				t.Fatal(err)
+			}
+			if *values["log-level"] != "debug" || *values["allowed-chats"] != "-100123,@alerts" {
+				t.Errorf("log-level = %q, allowed-chats = %q", *values["log-level"], *values["allowed-chats"])
+			}
+			if got := fs.Lookup("port").Value.String(); got != "50051" {
+				t.Errorf("port = %s", got)
+			}
+			if got := fs.Lookup("strict-args").Value.String(); got != "true" {
+				t.Errorf("strict-args = %s", got)
+			}
+		})
+	}
+}
+
+func TestApplyConfigFileCommandLineWins(t *testing.T) {
+	fs, values, err := testFlags("--log-level", "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, "plugin.yaml", "log-level: debug\nallowed-chats: \"@alerts\"\n")
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if *values["log-level"] != "error" {
+		t.Errorf("log-level = %q, want the command line's error", *values["log-level"])
+	}
+	if *values["allowed-chats"] != "@alerts" {
+		t.Errorf("allowed-chats = %q, want the file's @alerts", *values["allowed-chats"])
+	}
+}
+
+func TestApplyConfigFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, content, want string
+	}{
+		{"unknown key", "plugin.yaml", "log-level: debug\n\nalowed-chats: x\n", `plugin.yaml:3: unknown key "alowed-chats"`},
+		{"unknown key in json", "plugin.json", "{\n  \"port\": 1,\n  \"prot\": 2\n}", `plugin.json:3: unknown key "prot"`},
+		{"invalid value", "plugin.yaml", "port: 1\nstrict-args: maybe\n", `plugin.yaml:2: invalid value "maybe" for strict-args`},
+		{"nested value", "plugin.yaml", "log-level:\n  level: debug\n", "plugin.yaml:2: log-level: must be a value or a list of values"},
+		{"nested list", "plugin.yaml", "allowed-chats:\n  - [a, b]\n", "plugin.yaml:2: allowed-chats: list items must be plain values"},
+		{"not a mapping", "plugin.yaml", "- port\n", "plugin.yaml:1: config must be a mapping"},
+		{"config key", "plugin.yaml", "config: other.yaml\n", "plugin.yaml:1: config cannot be set in a config file"},
+		{"version key", "plugin.yaml", "port: 1\nversion: true\n", "plugin.yaml:2: version cannot be set in a config file"},
+		{"syntax", "plugin.yaml", "port: [1\n", "plugin.yaml: yaml:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, _, _ := testFlags()
+			err := applyConfigFile(fs, writeConfig(t, tc.file, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfigFileEmpty(t *testing.T) {
+	fs, values, _ := testFlags()
+	if err := applyConfigFile(fs, writeConfig(t, "plugin.yaml", "")); err != nil {
+		t.Fatal(err)
+	}
+	if *values["log-level"] != "info" {
+		t.Errorf("log-level = %q after an empty file", *values["log-level"])
+	}
+	if err := applyConfigFile(fs, filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
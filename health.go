@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// handleHealthCheck reports that the plugin is serving calls, with its
+// version and, when --spool-dir is set, how many sends are waiting in the
+// spool and how many were set aside as undeliverable. It does not call
+// Telegram.
+func (t *TelegramPlugin) handleHealthCheck(ctx context.Context, args map[string]any) sdk.Response {
+	data := map[string]any{"healthy": true, "version": currentBuild().Version}
+	if sp := t.state.spool; sp != nil {
+		pending, failed := sp.depth()
+		data["spoolDepth"] = pending
+		data["spoolFailed"] = failed
+	}
+	return succeed(data)
+}
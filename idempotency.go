@@ -0,0 +1,105 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// idempotencyCache remembers the messages sent for recent idempotency keys
+// so a retried send can return the original messages instead of delivering
+// them twice. Entries are evicted least-recently-used beyond size and expire
+// after ttl. The cache lives in memory and does not survive restarts.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+}
+
+type idempotencyEntry struct {
+	key        string
+	expires    time.Time
+	done       chan struct{} // closed once the owning send finished
+	messageIDs []string      // set on success before done is closed
+}
+
+func newIdempotencyCache(size int, ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// do runs send unless a send for key already succeeded within the TTL, in
+// which case it returns the recorded message IDs and deduplicated=true. A
+// duplicate arriving while the first send is still in flight waits for it
+// rather than sending in parallel. Failed sends are not recorded, so the
+// caller's next retry sends again.
+func (c *idempotencyCache) do(key string, send func() ([]string, error)) (messageIDs []string, deduplicated bool, err error) {
+	for {
+		entry, owner := c.begin(key)
+		if owner {
+			messageIDs, err := send()
+			c.finish(entry, messageIDs, err)
+			return messageIDs, false, err
+		}
+
+		<-entry.done
+		if entry.messageIDs != nil {
+			return entry.messageIDs, true, nil
+		}
+		// The send we waited on failed; try to become the owner.
+	}
+}
+
+// record stores messageIDs for key as if a send had just succeeded, unless
+// key already has an entry.
+func (c *idempotencyCache) record(key string, messageIDs []string) {
+	if entry, owner := c.begin(key); owner {
+		c.finish(entry, messageIDs, nil)
+	}
+}
+
+func (c *idempotencyCache) begin(key string) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*idempotencyEntry)
+		if now.Before(entry.expires) {
+			c.order.MoveToFront(el)
+			return entry, false
+		}
+		c.remove(el)
+	}
+
+	entry := &idempotencyEntry{key: key, expires: now.Add(c.ttl), done: make(chan struct{})}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return entry, true
+}
+
+func (c *idempotencyCache) finish(entry *idempotencyEntry, messageIDs []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		entry.messageIDs = messageIDs
+		entry.expires = time.Now().Add(c.ttl)
+	} else if el, ok := c.entries[entry.key]; ok && el.Value == entry {
+		c.remove(el)
+	}
+	close(entry.done)
+}
+
+func (c *idempotencyCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*idempotencyEntry).key)
+}
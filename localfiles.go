@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localFilesRoot, set by --allow-local-files and --local-files-root, is the
+// directory media methods may read filePath uploads from. Empty disables
+// filePath.
+var localFilesRoot string
+
+// readLocalFile reads a filePath upload. Relative paths are taken from
+// localFilesRoot, and the resolved file, symlinks followed, must be inside
+// it so a caller cannot read arbitrary files.
+func readLocalFile(path string) ([]byte, error) {
+	if localFilesRoot == "" {
+		return nil, argErrorf("filePath requires the plugin to be started with --allow-local-files")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(localFilesRoot, path)
+	}
+	// Check the path as written first, so errors do not reveal which files
+	// exist outside the root.
+	if !insideRoot(filepath.Clean(path)) {
+		return nil, argErrorf("filePath must be inside %s", localFilesRoot)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, argErrorf("filePath: %v", unwrapPathError(err))
+	}
+	if !insideRoot(real) {
+		return nil, argErrorf("filePath must be inside %s", localFilesRoot)
+	}
+
+	fi, err := os.Stat(real)
+	if err != nil {
+		return nil, argErrorf("filePath: %v", unwrapPathError(err))
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, argErrorf("filePath must be a regular file")
+	}
+	if fi.Size() > maxUploadBytes {
+		return nil, fmt.Errorf("file is %d bytes, uploads are limited to %d: %w", fi.Size(), maxUploadBytes, errTooLarge)
+	}
+	data, err := os.ReadFile(real)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filePath: %w", unwrapPathError(err))
+	}
+	return data, nil
+}
+
+func insideRoot(path string) bool {
+	rel, err := filepath.Rel(localFilesRoot, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// unwrapPathError drops the path from an *os.PathError, which callers
+// already know.
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// setLocalFilesRoot validates --local-files-root for --allow-local-files.
+func setLocalFilesRoot(root string) error {
+	if root == "" {
+		return fmt.Errorf("--allow-local-files requires --local-files-root")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return fmt.Errorf("--local-files-root: %w", err)
+	}
+	if fi, err := os.Stat(real); err != nil || !fi.IsDir() {
+		return fmt.Errorf("--local-files-root %s is not a directory", root)
+	}
+	localFilesRoot = real
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setTestRoot makes a root with a file, a subdirectory and symlinks, next to
+// a file outside it, and points localFilesRoot at it as given by root.
+func setTestRoot(t *testing.T, root func(dir string) string) (dir, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	dir = filepath.Join(base, "root")
+	outside = filepath.Join(base, "secret.txt")
+	for path, content := range map[string]string{
+		filepath.Join(dir, "a.txt"):        "inside",
+		filepath.Join(dir, "sub", "b.txt"): "nested",
+		outside:                            "secret",
+	} {
+		os.MkdirAll(filepath.Dir(path), 0o700)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink(outside, filepath.Join(dir, "escape"))
+	os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "alias"))
+	os.Symlink(base, filepath.Join(dir, "up"))
+
+	saved := localFilesRoot
+	t.Cleanup(func() { localFilesRoot = saved })
+	if err := setLocalFilesRoot(root(dir)); err != nil {
+		t.Fatal(err)
+	}
+	return dir, outside
+}
+
+func TestReadLocalFile(t *testing.T) {
+	for _, root := range []struct {
+		name string
+		path func(dir string) string
+	}{
+		{"root", func(dir string) string { return dir }},
+		{"root with trailing slash", func(dir string) string { return dir + string(filepath.Separator) }},
+	} {
+		t.Run(root.name, func(t *testing.T) {
+			dir, outside := setTestRoot(t, root.path)
+			for _, tc := range []struct {
+				name string
+				path string
+				want string // empty when the read must be rejected
+			}{
+				{"relative", "a.txt", "inside"},
+				{"nested", "sub/b.txt", "nested"},
+				{"absolute inside", filepath.Join(dir, "sub", "b.txt"), "nested"},
+				{"dot segments inside", "sub/../a.txt", "inside"},
+				{"symlink inside", "alias", "inside"},
+				{"traversal", "../secret.txt", ""},
+				{"deep traversal", "sub/../../secret.txt", ""},
+				{"absolute outside", outside, ""},
+				{"root's sibling prefix", dir + "2/a.txt", ""},
+				{"symlink escaping", "escape", ""},
+				{"symlinked directory escaping", "up/secret.txt", ""},
+				{"directory", "sub", ""},
+				{"missing", "nope.txt", ""},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					data, err := readLocalFile(tc.path)
+					if tc.want == "" {
+						if err == nil {
+							t.Fatalf("read %q, want an error", data)
+						}
+						if errorCode(err) != codeInvalidArgs {
+							t.Errorf("error code %s, want %s", errorCode(err), codeInvalidArgs)
+						}
+						return
+					}
+					if err != nil || string(data) != tc.want {
+						t.Errorf("readLocalFile = %q, %v; want %q", data, err, tc.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestReadLocalFileDisabled(t *testing.T) {
+	saved := localFilesRoot
+	localFilesRoot = ""
+	t.Cleanup(func() { localFilesRoot = saved })
+
+	path := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(path, []byte("data"), 0o600)
+	if _, err := readLocalFile(path); err == nil || errorCode(err) != codeInvalidArgs {
+		t.Errorf("readLocalFile with the flag off = %v, want INVALID_ARGS", err)
+	}
+}
+
+func TestSendMediaGroupFilePath(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	_, outside := setTestRoot(t, func(dir string) string { return dir })
+
+	photo := func(key, value string) map[string]any {
+		return map[string]any{"type": "photo", key: value}
+	}
+	data := call(t, p, "SendMediaGroup", map[string]any{"token": "1:T", "chatID": "1", "media": []any{
+		photo("filePath", "a.txt"), photo("media", "https://example.com/b.jpg"),
+	}})
+	if ids, _ := data["messageIDs"].([]string); len(ids) != 2 {
+		t.Errorf("messageIDs = %v", data["messageIDs"])
+	}
+
+	for name, item := range map[string]map[string]any{
+		"outside root":       photo("filePath", outside),
+		"filePath and media": {"type": "photo", "filePath": "a.txt", "media": "https://example.com/a.jpg"},
+	} {
+		res := callRaw(t, p, "SendMediaGroup", map[string]any{"token": "1:T", "chatID": "1", "media": []any{item, photo("media", "x")}})
+		if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+			t.Errorf("%s: Success=%v errorCode=%v, want INVALID_ARGS", name, res.Success, data["errorCode"])
+		}
+	}
+	if got := stub.count("sendMediaGroup"); got != 1 {
+		t.Errorf("sendMediaGroup called %d times, want 1", got)
+	}
+}
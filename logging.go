@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// logger writes JSON logs to stderr. main() sets the level from --log-level;
+// hosts loading the plugin in-process through OrkaCall only see errors.
+var logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+func newLogger(level string) (*slog.Logger, error) {
+	var l slog.Level
+	switch level {
+	case "error":
+		l = slog.LevelError
+	case "info":
+		l = slog.LevelInfo
+	case "debug":
+		l = slog.LevelDebug
+	default:
+		return nil, fmt.Errorf("invalid log level %q (want error, info or debug)", level)
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: l})), nil
+}
+
+// sensitiveArgs hold credentials or message contents. Their values are
+// never logged, not even at debug level.
+var sensitiveArgs = map[string]bool{
+	"token":          true,
+	"secretToken":    true,
+	"providedSecret": true,
+	"expectedSecret": true,
+	"providerToken":  true,
+	"text":           true,
+	"caption":        true,
+	"question":       true,
+	"options":        true,
+	"voiceData":      true,
+	"data":           true,
+	"variables":      true,
+	"update":         true,
+	"phoneNumber":    true,
+	"firstName":      true,
+	"lastName":       true,
+	"vcard":          true,
+	"thumbnail":      true,
+	"payload":        true,
+	"title":          true,
+	"description":    true,
+	"address":        true,
+	"latitude":       true,
+	"longitude":      true,
+	"explanation":    true,
+}
+
+// maxLoggedString is the longest string argument logged as is; longer ones,
+// typically base64 uploads under an unexpected name, are logged as their
+// length, like bytes.
+const maxLoggedString = 256
+
+// logCall records one CallMethod invocation. Failures are logged at error
+// level, successes at info; the redacted arguments are added at debug.
+func logCall(ctx context.Context, req sdk.Request, res *sdk.Response, d time.Duration) {
+	attrs := append([]any{"method", req.Method}, callAttrs(ctx)...)
+	attrs = append(attrs,
+		"durationMs", d.Milliseconds(),
+		"success", res.Success,
+	)
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, "args", redact(req.Args))
+	}
+
+	if !res.Success {
+		logger.Error("call failed", append(attrs, "error", res.Error)...)
+		return
+	}
+	logger.Info("call", attrs...)
+}
+
+// redact returns a copy of v with sensitive values replaced, descending into
+// nested objects and arrays such as SendMediaGroup items.
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, val := range v {
+			if sensitiveArgs[key] {
+				out[key] = "[REDACTED]"
+				continue
+			}
+			out[key] = redact(val)
+		}
+		return out
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = redact(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = redact(item)
+		}
+		return out
+	case []byte:
+		return fmt.Sprintf("[%d bytes]", len(v))
+	case string:
+		if len(v) > maxLoggedString {
+			return fmt.Sprintf("[%d bytes]", len(v))
+		}
+		return v
+	default:
+		return v
+	}
+}
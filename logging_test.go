@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	long := strings.Repeat("A", maxLoggedString+1)
+	got := redact(map[string]any{
+		"chatID":    "1",
+		"thumbnail": "aGVsbG8=",
+		"payload":   "order-42",
+		"latitude":  52.5,
+		"blob":      long,
+		"raw":       []byte("hello"),
+		"media":     []any{map[string]any{"type": "photo", "caption": "secret"}},
+	}).(map[string]any)
+
+	for key, want := range map[string]any{
+		"chatID":    "1",
+		"thumbnail": "[REDACTED]",
+		"payload":   "[REDACTED]",
+		"latitude":  "[REDACTED]",
+		"blob":      "[257 bytes]",
+		"raw":       "[5 bytes]",
+	} {
+		if got[key] != want {
+			t.Errorf("%s logged as %v, want %v", key, got[key], want)
+		}
+	}
+	item := got["media"].([]any)[0].(map[string]any)
+	if item["caption"] != "[REDACTED]" || item["type"] != "photo" {
+		t.Errorf("media item logged as %v", item)
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"flag"
 	"fmt"
-	"net/http"
-	"net/url"
+	"log"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	sdk "github.com/orka-platform/orka-plugin-sdk"
 )
@@ -16,63 +22,388 @@ func init() {
 	gob.Register([]string{})
 }
 
-type TelegramPlugin struct{}
+// TelegramPlugin is the RPC service. Everything it keeps between calls is
+// in state, which is safe for the concurrent calls net/rpc makes.
+type TelegramPlugin struct {
+	state *state
+}
+
+func newTelegramPlugin(st *state) *TelegramPlugin {
+	return &TelegramPlugin{state: st}
+}
 
 func (t *TelegramPlugin) CallMethod(req sdk.Request, res *sdk.Response) error {
-	switch req.Method {
-	case "SendMessage":
-		token, _ := req.Args["token"].(string)
-		chatID, _ := req.Args["chatID"].(string)
-		text, _ := req.Args["text"].(string)
-
-		if token == "" || chatID == "" || text == "" {
-			*res = sdk.Response{
-				Success: false,
-				Error:   "token, chatID and text are required",
-			}
-			return nil
+	// Invalid IDs are replaced here and rejected by dispatch.
+	requestID, err := callIDArg(req.Args, "requestID")
+	if err != nil || requestID == "" {
+		requestID = newRequestID()
+	}
+	correlationID, err := callIDArg(req.Args, "_correlationID")
+	if err != nil || correlationID == "" {
+		correlationID = newRequestID()
+	}
+	ctx := withCorrelationID(withRequestID(context.Background(), requestID), correlationID)
+	// A panic that gets past the middleware, or happens in it, must not
+	// reach net/rpc, which would crash the plugin and every call in flight.
+	defer func() {
+		if p := recover(); p != nil {
+			*res = panicResponse(ctx, req, p)
 		}
+		echoCallIDs(ctx, res)
+	}()
+	*res = chain(middlewareChain, t.dispatch)(ctx, req)
+	return nil
+}
 
-		err := sendTelegramMessage(token, chatID, text)
-		if err != nil {
-			*res = sdk.Response{Success: false, Error: err.Error()}
-		} else {
-			*res = sdk.Response{Success: true, Data: map[string]any{"messageID": "123"}}
+// dispatch checks a call's arguments and runs its method.
+func (t *TelegramPlugin) dispatch(ctx context.Context, req sdk.Request) sdk.Response {
+	for _, key := range []string{"requestID", "_correlationID"} {
+		if _, err := callIDArg(req.Args, key); err != nil {
+			return fail(err)
 		}
-		return nil
+	}
+	if err := checkArgs(req.Method, req.Args); err != nil {
+		return fail(err)
+	}
+	if err := checkChatAllowed(req.Method, req.Args); err != nil {
+		return fail(err)
+	}
+
+	switch req.Method {
+	case "SendMessage":
+		return t.handleSendMessage(ctx, req.Args)
+
+	case "SendTemplate":
+		return t.handleSendTemplate(ctx, req.Args)
+
+	case "SendMediaGroup":
+		return t.handleSendMediaGroup(ctx, req.Args)
+
+	case "SendChatAction":
+		return t.handleSendChatAction(ctx, req.Args)
+
+	case "ForwardMessage":
+		return t.handleForwardMessage(ctx, req.Args)
+
+	case "SendPoll":
+		return t.handleSendPoll(ctx, req.Args)
+
+	case "GetFile":
+		return t.handleGetFile(ctx, req.Args)
+
+	case "AnswerCallbackQuery":
+		return t.handleAnswerCallbackQuery(ctx, req.Args)
+
+	case "BanChatMember":
+		return t.handleBanChatMember(ctx, req.Args)
+
+	case "UnbanChatMember":
+		return t.handleUnbanChatMember(ctx, req.Args)
+
+	case "SetWebhook":
+		return t.handleSetWebhook(ctx, req.Args)
+
+	case "VerifyWebhookSecret":
+		return t.handleVerifyWebhookSecret(ctx, req.Args)
+
+	case "DeleteWebhook":
+		return t.handleDeleteWebhook(ctx, req.Args)
+
+	case "GetWebhookInfo":
+		return t.handleGetWebhookInfo(ctx, req.Args)
+
+	case "PinChatMessage":
+		return t.handlePinChatMessage(ctx, req.Args)
+
+	case "UnpinChatMessage":
+		return t.handleUnpinChatMessage(ctx, req.Args)
+
+	case "GetChat":
+		return t.handleGetChat(ctx, req.Args)
+
+	case "GetChatAdministrators":
+		return t.handleGetChatAdministrators(ctx, req.Args)
+
+	case "IsChatAdmin":
+		return t.handleIsChatAdmin(ctx, req.Args)
+
+	case "GetChatMemberCount":
+		return t.handleGetChatMemberCount(ctx, req.Args)
+
+	case "SendLocation":
+		return t.handleSendLocation(ctx, req.Args)
+
+	case "SendVenue":
+		return t.handleSendVenue(ctx, req.Args)
+
+	case "SetMyCommands":
+		return t.handleSetMyCommands(ctx, req.Args)
+
+	case "DeleteMyCommands":
+		return t.handleDeleteMyCommands(ctx, req.Args)
+
+	case "GetMyCommands":
+		return t.handleGetMyCommands(ctx, req.Args)
+
+	case "SendDice":
+		return t.handleSendDice(ctx, req.Args)
+
+	case "RestrictChatMember":
+		return t.handleRestrictChatMember(ctx, req.Args)
+
+	case "CopyMessage":
+		return t.handleCopyMessage(ctx, req.Args)
+
+	case "SetMessageReaction":
+		return t.handleSetMessageReaction(ctx, req.Args)
+
+	case "GetMe":
+		return t.handleGetMe(ctx, req.Args)
+
+	case "SendVideo":
+		return t.handleSendVideo(ctx, req.Args)
+
+	case "SendAudio":
+		return t.handleSendAudio(ctx, req.Args)
+
+	case "ProcessUpdate":
+		return t.handleProcessUpdate(ctx, req.Args)
+
+	case "EditMessageReplyMarkup":
+		return t.handleEditMessageReplyMarkup(ctx, req.Args)
+
+	case "SendContact":
+		return t.handleSendContact(ctx, req.Args)
+
+	case "StartPolling":
+		return t.handleStartPolling(ctx, req.Args)
+
+	case "StopPolling":
+		return t.handleStopPolling(ctx, req.Args)
+
+	case "SendInvoice":
+		return t.handleSendInvoice(ctx, req.Args)
+
+	case "AnswerPreCheckoutQuery":
+		return t.handleAnswerPreCheckoutQuery(ctx, req.Args)
+
+	case "CancelScheduled":
+		return t.handleCancelScheduled(ctx, req.Args)
+
+	case "SendPhoto":
+		return t.handleSendPhoto(ctx, req.Args)
+
+	case "SendDocument":
+		return t.handleSendDocument(ctx, req.Args)
+
+	case "SendVoice":
+		return t.handleSendVoice(ctx, req.Args)
+
+	case "SendSticker":
+		return t.handleSendSticker(ctx, req.Args)
+
+	case "GetStickerSet":
+		return t.handleGetStickerSet(ctx, req.Args)
+
+	case "ExportChatInviteLink":
+		return t.handleExportChatInviteLink(ctx, req.Args)
+
+	case "CreateChatInviteLink":
+		return t.handleCreateChatInviteLink(ctx, req.Args)
+
+	case "LeaveChat":
+		return t.handleLeaveChat(ctx, req.Args)
+
+	case "CreateForumTopic":
+		return t.handleCreateForumTopic(ctx, req.Args)
+
+	case "SendToTopic":
+		return t.handleSendToTopic(ctx, req.Args)
+
+	case "EditForumTopic":
+		return t.handleEditForumTopic(ctx, req.Args)
+
+	case "CloseForumTopic":
+		return t.handleCloseForumTopic(ctx, req.Args)
+
+	case "ReopenForumTopic":
+		return t.handleReopenForumTopic(ctx, req.Args)
+
+	case "FlushSpool":
+		return t.handleFlushSpool(ctx, req.Args)
+
+	case "Version":
+		return t.handleVersion(ctx, req.Args)
+
+	case "HealthCheck":
+		return t.handleHealthCheck(ctx, req.Args)
 
 	default:
-		*res = sdk.Response{
+		return sdk.Response{
 			Success: false,
 			Error:   fmt.Sprintf("unknown method: %s", req.Method),
+			Data:    map[string]any{"errorCode": codeUnknownMethod},
 		}
-		return nil
 	}
 }
 
-func sendTelegramMessage(token, chatID, text string) error {
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token)
+// OrkaCall is the exported entrypoint symbol for in-process usage.
+// It wraps the existing rpc-style method for minimal change.
+func OrkaCall(req sdk.Request, res *sdk.Response) error {
+	return inProcessPlugin().CallMethod(req, res)
+}
+
+func main() {
+	port := flag.Int("port", 0, "TCP port for RPC server")
+	socket := flag.String("socket", "", "Unix domain socket path for RPC server (used instead of --port)")
+	middlewareList := flag.String("middleware", defaultMiddleware, "Comma-separated middleware run around every call, outermost first: tracing, logging, metrics, recover")
+	codec := flag.String("codec", "gob", "RPC encoding: gob (net/rpc, used by Orka) or json (JSON-RPC 1.0, for callers not written in Go)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "How long to wait for in-flight calls on shutdown")
+	logLevel := flag.String("log-level", "info", "Log verbosity: error, info or debug")
+	idempotencySize := flag.Int("idempotency-cache-size", defaultIdempotencySize, "Number of SendMessage idempotency keys to remember")
+	idempotencyTTL := flag.Duration("idempotency-ttl", defaultIdempotencyTTL, "How long SendMessage idempotency keys are remembered")
+	flag.StringVar(&userAgent, "user-agent", userAgent, "User-Agent header sent to the Bot API")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Export OpenTelemetry traces to this OTLP/HTTP endpoint, e.g. http://localhost:4318 (disabled when empty)")
+	maxIdleConns := flag.Int("http-max-idle-conns", defaultMaxIdleConnsPerHost, "Idle connections to the Bot API kept open for reuse")
+	idleConnTimeout := flag.Duration("http-idle-conn-timeout", defaultIdleConnTimeout, "How long an idle Bot API connection is kept open")
+	allowed := flag.String("allowed-chats", "", "Comma-separated chat IDs and @usernames send methods may post to (all chats when empty)")
+	flag.BoolVar(&strictArgs, "strict-args", false, "Reject arguments a method does not declare in config.json, to catch typos")
+	allowLocalFiles := flag.Bool("allow-local-files", false, "Let media methods upload files from disk with filePath, for trusted in-process callers")
+	localRoot := flag.String("local-files-root", "", "Directory filePath uploads must be inside; required with --allow-local-files")
+	templatesDir := flag.String("templates-dir", "", "Directory of SendTemplate message templates (.txt, .html or .md text/template files)")
+	offsetFile := flag.String("offset-file", "", "File where StartPolling offsets are saved so polling resumes after a restart (in memory only when empty)")
+	spoolDir := flag.String("spool-dir", "", "Directory where SendMessage calls that fail while Telegram is unreachable are kept and retried (disabled when empty)")
+	configPath := flag.String("config", "", "YAML or JSON file of flag values; flags given on the command line take precedence")
+	metricsPort := flag.Int("metrics-port", 0, "Serve Prometheus metrics on this localhost port (disabled when 0)")
+	showVersion := flag.Bool("version", false, "Print the plugin's version, commit and build date and exit")
+	flag.Parse()
 
-	data := url.Values{}
-	data.Set("chat_id", chatID)
-	data.Set("text", text)
+	if *showVersion {
+		fmt.Println(currentBuild())
+		return
+	}
 
-	resp, err := http.PostForm(apiURL, data)
+	if *configPath != "" {
+		if err := applyConfigFile(flag.CommandLine, *configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	l, err := newLogger(*logLevel)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
+	logger = l
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("telegram API returned status: %s", resp.Status)
+	if middlewareChain, err = parseMiddleware(*middlewareList); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	return nil
-}
+	serveConn, ok := codecs[*codec]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown --codec %q; use gob or json\n", *codec)
+		os.Exit(1)
+	}
 
-// OrkaCall is the exported entrypoint symbol for in-process usage.
-// It wraps the existing rpc-style method for minimal change.
-func OrkaCall(req sdk.Request, res *sdk.Response) error {
-	var t TelegramPlugin
-	return t.CallMethod(req, res)
+	if *idempotencySize <= 0 || *idempotencyTTL <= 0 {
+		fmt.Fprintln(os.Stderr, "--idempotency-cache-size and --idempotency-ttl must be positive")
+		os.Exit(1)
+	}
+	plugin := newTelegramPlugin(newState(*idempotencySize, *idempotencyTTL))
+
+	if *offsetFile != "" {
+		plugin.state.pollers.loadOffsets(*offsetFile)
+	}
+
+	if allowedChats, err = parseAllowedChats(*allowed); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *templatesDir != "" {
+		if messageTemplates, err = loadTemplates(*templatesDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *allowLocalFiles {
+		if err := setLocalFilesRoot(*localRoot); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *maxIdleConns <= 0 || *idleConnTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "--http-max-idle-conns and --http-idle-conn-timeout must be positive")
+		os.Exit(1)
+	}
+	telegramClient = newTelegramClient(*maxIdleConns, *idleConnTimeout)
+
+	if *port == 0 && *socket == "" {
+		fmt.Fprintln(os.Stderr, "Missing required --port or --socket argument")
+		os.Exit(1)
+	}
+
+	if *spoolDir != "" {
+		sp, err := openSpool(*spoolDir, plugin.state.sent)
+		if err != nil {
+			log.Fatalf("Failed to open spool: %v", err)
+		}
+		plugin.state.spool = sp
+		// Stopped and waited for with the other background work on shutdown.
+		plugin.state.background.run(context.Background(), sp.run)
+	}
+
+	if err := rpc.Register(plugin); err != nil {
+		log.Fatalf("RPC register error: %v", err)
+	}
+
+	if *otlpEndpoint != "" {
+		shutdownTracing, err := setupTracing(context.Background(), *otlpEndpoint)
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to flush traces: %v\n", err)
+			}
+		}()
+	}
+
+	if *metricsPort != 0 {
+		if err := serveMetrics(*metricsPort); err != nil {
+			log.Fatalf("Failed to start metrics server: %v", err)
+		}
+	}
+
+	ln, err := listenWithRetry(*port, *socket)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	srv := newServer(ln, serveConn)
+	go srv.serve()
+	fmt.Printf("Telegram plugin listening on %s\n", ln.Addr())
+
+	sig := <-sigCh
+	fmt.Printf("Received %s, shutting down\n", sig)
+	stopped := srv.shutdown(*shutdownTimeout)
+	stopCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	plugin.state.pollers.stopAll(stopCtx)
+	plugin.state.background.stopAll(stopCtx)
+	cancel()
+	if stopped {
+		fmt.Println("Telegram plugin stopped cleanly")
+	} else {
+		fmt.Printf("Telegram plugin stopped after %s with calls still in flight\n", *shutdownTimeout)
+	}
 }
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// botAPIStub is an httptest stand-in for the Bot API. It answers the
+// methods the tests call and counts the calls per method.
+type botAPIStub struct {
+	calls sync.Map // method name to *atomic.Int64
+	next  atomic.Int64
+	// errorCode, when set, makes every call fail with that Bot API code.
+	errorCode atomic.Int64
+	// failChats makes sends to a chat_id fail with the stored code.
+	failChats sync.Map
+	// usernames maps @usernames sendMessage cannot find, as happens for
+	// some private chats, to the IDs getChat resolves them to. An empty ID
+	// makes getChat fail too.
+	usernames sync.Map
+
+	mu    sync.Mutex
+	texts map[string][]string   // chat_id to the texts sent there
+	forms map[string]url.Values // method to the form of its latest call
+}
+
+// lastForm returns the form of the latest call to method.
+func (s *botAPIStub) lastForm(method string) url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forms[method]
+}
+
+// sentTexts returns the texts sendMessage delivered to chatID.
+func (s *botAPIStub) sentTexts(chatID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.texts[chatID]
+}
+
+func (s *botAPIStub) count(method string) int64 {
+	n, _ := s.calls.LoadOrStore(method, new(atomic.Int64))
+	return n.(*atomic.Int64).Load()
+}
+
+func (s *botAPIStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	n, _ := s.calls.LoadOrStore(method, new(atomic.Int64))
+	n.(*atomic.Int64).Add(1)
+
+	r.ParseMultipartForm(1 << 20)
+	chatID := r.FormValue("chat_id")
+	s.mu.Lock()
+	if s.forms == nil {
+		s.forms = map[string]url.Values{}
+	}
+	s.forms[method] = r.Form
+	s.mu.Unlock()
+	if code, ok := s.failChats.Load(chatID); ok {
+		json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": code, "description": "stub error"})
+		return
+	}
+	if _, ok := s.usernames.Load(chatID); ok && method == "sendMessage" {
+		json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"})
+		return
+	}
+	if code := s.errorCode.Load(); code != 0 {
+		// Rate limits say how long to wait, as Telegram's do.
+		json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": code, "description": "stub error", "parameters": map[string]any{"retry_after": 7}})
+		return
+	}
+	var result any = true
+	switch method {
+	case "sendMessage":
+		s.mu.Lock()
+		if s.texts == nil {
+			s.texts = map[string][]string{}
+		}
+		s.texts[chatID] = append(s.texts[chatID], r.FormValue("text"))
+		s.mu.Unlock()
+		chat := map[string]any{"id": 1}
+		if strings.HasPrefix(chatID, "@") {
+			chat["username"] = chatID[1:]
+		} else if id, err := strconv.ParseInt(chatID, 10, 64); err == nil {
+			chat["id"] = id
+		}
+		result = map[string]any{"message_id": s.next.Add(1), "date": time.Now().Unix(), "chat": chat}
+	case "createForumTopic":
+		result = map[string]any{"message_thread_id": s.next.Add(1), "name": r.FormValue("name"), "icon_color": 7322096, "icon_custom_emoji_id": r.FormValue("icon_custom_emoji_id")}
+	case "sendPoll":
+		result = map[string]any{"message_id": s.next.Add(1), "date": time.Now().Unix(), "chat": map[string]any{"id": 1}, "poll": map[string]any{"id": "p1"}}
+	case "sendPhoto", "sendDocument", "sendVoice":
+		result = map[string]any{"message_id": s.next.Add(1), "date": time.Now().Unix(), "chat": map[string]any{"id": 1}}
+	case "sendMediaGroup":
+		result = []any{
+			map[string]any{"message_id": s.next.Add(1), "date": time.Now().Unix(), "chat": map[string]any{"id": 1}},
+			map[string]any{"message_id": s.next.Add(1), "date": time.Now().Unix(), "chat": map[string]any{"id": 1}},
+		}
+	case "getChat":
+		id, ok := s.usernames.Load(chatID)
+		if !ok || id == "" {
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"})
+			return
+		}
+		result = map[string]any{"id": json.RawMessage(id.(string))}
+	case "getWebhookInfo":
+		result = map[string]any{"url": ""}
+	case "getUpdates":
+		// Long polls end when the poller is stopped.
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		result = []any{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+// newStubbedPlugin returns a plugin whose Bot API calls go to a stub.
+func newStubbedPlugin(t *testing.T) (*TelegramPlugin, *botAPIStub) {
+	t.Helper()
+	stub := &botAPIStub{}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	base := telegramAPIBase
+	telegramAPIBase = srv.URL
+	t.Cleanup(func() { telegramAPIBase = base })
+
+	return newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL)), stub
+}
+
+// callRaw runs one call and returns its response, failed or not.
+func callRaw(t *testing.T, p *TelegramPlugin, method string, args map[string]any) sdk.Response {
+	t.Helper()
+	var res sdk.Response
+	if err := p.CallMethod(sdk.Request{Method: method, Args: args}, &res); err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	return res
+}
+
+// call runs one call that is expected to succeed and returns its data.
+func call(t *testing.T, p *TelegramPlugin, method string, args map[string]any) map[string]any {
+	t.Helper()
+	res := callRaw(t, p, method, args)
+	data, _ := res.Data.(map[string]any)
+	if !res.Success {
+		t.Errorf("%s failed: %s (%v)", method, res.Error, data["errorCode"])
+	}
+	return data
+}
+
+// concurrently runs f(i) for i in [0, n) on n goroutines and waits for all.
+func concurrently(n int, f func(i int)) {
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(i)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentSendMessageSameIdempotencyKey(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+
+	const n = 20
+	results := make([]map[string]any, n)
+	concurrently(n, func(i int) {
+		results[i] = call(t, p, "SendMessage", map[string]any{
+			"token": "1:T", "chatID": "1", "text": "hi", "idempotencyKey": "k",
+		})
+	})
+
+	if got := stub.count("sendMessage"); got != 1 {
+		t.Errorf("sendMessage called %d times, want 1", got)
+	}
+	deduplicated := 0
+	for _, data := range results {
+		if data["messageID"] != results[0]["messageID"] {
+			t.Errorf("messageID %v, want %v for every call", data["messageID"], results[0]["messageID"])
+		}
+		if data["deduplicated"] == true {
+			deduplicated++
+		}
+	}
+	if deduplicated != n-1 {
+		t.Errorf("%d calls deduplicated, want %d", deduplicated, n-1)
+	}
+
+	sent := p.state.sent
+	sent.mu.Lock()
+	defer sent.mu.Unlock()
+	if len(sent.entries) != 1 {
+		t.Errorf("idempotency cache holds %d keys, want 1", len(sent.entries))
+	}
+}
+
+func TestConcurrentStartStopPolling(t *testing.T) {
+	p, _ := newStubbedPlugin(t)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer callback.Close()
+
+	tokens := []string{"1:A", "2:B", "3:C", "4:D"}
+	concurrently(len(tokens), func(i int) {
+		call(t, p, "StartPolling", map[string]any{"token": tokens[i], "callbackURL": callback.URL})
+	})
+
+	ps := p.state.pollers
+	ps.mu.Lock()
+	running := len(ps.running)
+	ps.mu.Unlock()
+	if running != len(tokens) {
+		t.Fatalf("%d pollers running, want %d", running, len(tokens))
+	}
+
+	concurrently(len(tokens), func(i int) {
+		if data := call(t, p, "StopPolling", map[string]any{"token": tokens[i]}); data["stopped"] != true {
+			t.Errorf("StopPolling(%s) stopped = %v, want true", tokens[i], data["stopped"])
+		}
+	})
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if len(ps.running) != 0 {
+		t.Errorf("%d pollers still running after StopPolling", len(ps.running))
+	}
+}
+
+func TestConcurrentScheduleAndCancel(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+
+	const n = 20
+	at := time.Now().Add(time.Hour).Format(time.RFC3339)
+	ids := make([]string, n)
+	concurrently(n, func(i int) {
+		data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": "later", "scheduleAt": at})
+		ids[i], _ = data["scheduledID"].(string)
+	})
+
+	s := p.state.scheduled
+	s.mu.Lock()
+	pending := len(s.pending)
+	s.mu.Unlock()
+	if pending != n {
+		t.Fatalf("%d messages scheduled, want %d", pending, n)
+	}
+
+	concurrently(n, func(i int) {
+		if data := call(t, p, "CancelScheduled", map[string]any{"token": "1:T", "scheduledID": ids[i]}); data["cancelled"] != true {
+			t.Errorf("CancelScheduled(%s) cancelled = %v, want true", ids[i], data["cancelled"])
+		}
+	})
+
+	s.mu.Lock()
+	pending = len(s.pending)
+	s.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d messages still scheduled after CancelScheduled", pending)
+	}
+	if data := call(t, p, "CancelScheduled", map[string]any{"token": "1:T", "scheduledID": ids[0]}); data["cancelled"] != false {
+		t.Errorf("second CancelScheduled cancelled = %v, want false", data["cancelled"])
+	}
+	if got := stub.count("sendMessage"); got != 0 {
+		t.Errorf("sendMessage called %d times for cancelled messages", got)
+	}
+}
+
+func TestShutdownStopsRepeatedChatAction(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+
+	call(t, p, "SendChatAction", map[string]any{"token": "1:T", "chatID": "1", "action": "typing", "repeatUntilMs": 60000})
+
+	start := time.Now()
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	p.state.background.stopAll(stopCtx)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("stopAll waited %s for the repeating chat action", elapsed)
+	}
+	if got := stub.count("sendChatAction"); got != 1 {
+		t.Errorf("sendChatAction called %d times, want 1", got)
+	}
+}
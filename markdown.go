@@ -0,0 +1,272 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markdownV2Reserved must be escaped wherever they are meant literally in
+// MarkdownV2 text.
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+var (
+	headingLine   = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)(\s+#+)?\s*$`)
+	ruleLine      = regexp.MustCompile(`^\s{0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	tableDivider  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	quoteLine     = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	bulletLine    = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	taskItem      = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	orderedLine   = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	fenceLanguage = regexp.MustCompile(`^[A-Za-z0-9_+#-]+$`)
+)
+
+// markdownToV2 converts GitHub-flavored Markdown, as LLMs typically write
+// it, into Telegram MarkdownV2. Code blocks, inline code, links, bold,
+// italic, strikethrough and blockquotes are kept. Headings become bold
+// lines, list markers bullets, and tables and images plain text. Everything
+// else is escaped so Telegram never rejects the message for stray markup.
+func markdownToV2(text string) string {
+	var out []string
+	var code []string
+	var fence, lang string
+	inFence := false
+
+	flushCode := func() {
+		out = append(out, "```"+lang+"\n"+escapeCode(strings.Join(code, "\n"))+"\n```")
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inFence {
+			if strings.HasPrefix(trimmed, fence) {
+				flushCode()
+				inFence = false
+				continue
+			}
+			code = append(code, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence, fence, code = true, trimmed[:3], nil
+			lang = strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			if !fenceLanguage.MatchString(lang) {
+				lang = ""
+			}
+			continue
+		}
+		if converted, keep := formatLine(line); keep {
+			out = append(out, converted)
+		}
+	}
+	// A block left open, e.g. by autoSplit cutting through it, is closed.
+	if inFence {
+		flushCode()
+	}
+	return strings.Join(out, "\n")
+}
+
+// formatLine converts one line outside a code block. It reports false for
+// lines that only carry layout, like table dividers.
+func formatLine(line string) (string, bool) {
+	if m := headingLine.FindStringSubmatch(line); m != nil {
+		return "*" + formatInline(m[1]) + "*", true
+	}
+	if ruleLine.MatchString(line) {
+		return "──────────", true
+	}
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "|") {
+		if tableDivider.MatchString(trimmed) {
+			return "", false
+		}
+		cells := strings.Split(strings.Trim(trimmed, "|"), "|")
+		for i, cell := range cells {
+			cells[i] = formatInline(strings.TrimSpace(cell))
+		}
+		return strings.Join(cells, " \\| "), true
+	}
+	if m := quoteLine.FindStringSubmatch(line); m != nil {
+		return ">" + formatInline(m[1]), true
+	}
+	if m := bulletLine.FindStringSubmatch(line); m != nil {
+		item := m[2]
+		marker := "•"
+		if t := taskItem.FindStringSubmatch(item); t != nil {
+			marker, item = "☐", t[2]
+			if t[1] != " " {
+				marker = "☑"
+			}
+		}
+		return m[1] + marker + " " + formatInline(item), true
+	}
+	if m := orderedLine.FindStringSubmatch(line); m != nil {
+		return m[1] + m[2] + "\\. " + formatInline(m[3]), true
+	}
+	return formatInline(line), true
+}
+
+// formatInline converts the inline markup of a line.
+func formatInline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(markdownV2Reserved, s[i+1]) >= 0:
+			// Already escaped in the source; keep it literal.
+			b.WriteByte('\\')
+			b.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 {
+				b.WriteString("`" + escapeCode(s[i+n:i+n+end]) + "`")
+				i += 2*n + end
+				continue
+			}
+
+		case c == '!' && strings.HasPrefix(s[i:], "!["):
+			if text, url, n, ok := parseLink(s[i+1:]); ok {
+				b.WriteString(escapeV2(text))
+				if url != "" {
+					b.WriteString(" \\(" + escapeV2(url) + "\\)")
+				}
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			// Telegram rejects links without text or target; those stay
+			// literal brackets.
+			if text, url, n, ok := parseLink(s[i:]); ok && text != "" && url != "" {
+				b.WriteString("[" + formatInline(text) + "](" + escapeURL(url) + ")")
+				i += n
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if out, n, ok := emphasis(s, i); ok {
+				b.WriteString(out)
+				i += n
+				continue
+			}
+		}
+
+		if strings.IndexByte(markdownV2Reserved, c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// emphasis converts the emphasis span opening at s[i], returning the
+// MarkdownV2 text and how many bytes of s it consumed.
+func emphasis(s string, i int) (string, int, bool) {
+	rest := s[i:]
+	for _, span := range []struct{ open, to string }{
+		{"**", "*"}, {"__", "*"}, {"~~", "~"}, {"*", "_"}, {"_", "_"},
+	} {
+		if !strings.HasPrefix(rest, span.open) {
+			continue
+		}
+		n := len(span.open)
+		// Underscores inside words, as in snake_case, are not emphasis.
+		if span.open[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+			return "", 0, false
+		}
+		end := closingMarker(rest[n:], span.open)
+		if end <= 0 || rest[n] == ' ' || rest[n+end-1] == ' ' {
+			continue
+		}
+		after := n + end + n
+		if span.open[0] == '_' && after < len(rest) && isWordByte(rest[after]) {
+			continue
+		}
+		return span.to + formatInline(rest[n:n+end]) + span.to, after, true
+	}
+	return "", 0, false
+}
+
+// closingMarker finds marker in s, skipping single-character markers that
+// are part of a doubled one.
+func closingMarker(s, marker string) int {
+	for from := 0; from < len(s); {
+		j := strings.Index(s[from:], marker)
+		if j < 0 {
+			return -1
+		}
+		j += from
+		if len(marker) == 1 && j+1 < len(s) && s[j+1] == marker[0] {
+			from = j + 2
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// parseLink parses "[text](url)" at the start of s.
+func parseLink(s string) (text, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			parens := 0
+			for j := i + 1; j < len(s); j++ {
+				switch s[j] {
+				case '(':
+					parens++
+				case ')':
+					parens--
+					if parens == 0 {
+						return s[1:i], strings.TrimSpace(s[i+2 : j]), j + 1, true
+					}
+				}
+			}
+			return "", "", 0, false
+		}
+	}
+	return "", "", 0, false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func escapeV2(s string) string {
+	return escapeChars(s, markdownV2Reserved)
+}
+
+// escapeCode escapes the text of inline code and code blocks, where only
+// backticks and backslashes are special.
+func escapeCode(s string) string {
+	return escapeChars(s, "`\\")
+}
+
+// escapeURL escapes a link target, where only ')' and backslashes are
+// special.
+func escapeURL(s string) string {
+	return escapeChars(s, ")\\")
+}
+
+func escapeChars(s, special string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(special, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
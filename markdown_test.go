@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMarkdownToV2(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"bold", "**bold**", "*bold*"},
+		{"bold underscores", "__bold__", "*bold*"},
+		{"italic", "*italic*", "_italic_"},
+		{"italic underscores", "_italic_", "_italic_"},
+		{"strikethrough", "~~strike~~", "~strike~"},
+		{"inline code", "`code`", "`code`"},
+		{"inline code with a backtick", "``a`b``", "`a\\`b`"},
+		{"code keeps markup", "`*stars* and _under_ [x](y)`", "`*stars* and _under_ [x](y)`"},
+		{"code escapes backslash", "`a\\b`", "`a\\\\b`"},
+		{"pre", "```go\nfmt.Println(\"a_b*c.\")\n```", "```go\nfmt.Println(\"a_b*c.\")\n```"},
+		{"pre escapes backticks", "```\nx `y` \\z\n```", "```\nx \\`y\\` \\\\z\n```"},
+		{"pre with odd language", "```not a lang!\nx\n```", "```\nx\n```"},
+		{"unterminated pre", "```js\nx()", "```js\nx()\n```"},
+		{"link", "[link](https://example.com/a_b)", "[link](https://example.com/a_b)"},
+		{"link with parens", "[x](https://example.com/a_(b))", "[x](https://example.com/a_(b\\))"},
+		{"formatted link text", "[**bold** link!](https://x.y/)", "[*bold* link\\!](https://x.y/)"},
+		{"image", "![alt](https://x/img.png)", "alt \\(https://x/img\\.png\\)"},
+		{"reserved characters", "_*[]()~>#+-=|{}.!", "\\_\\*\\[\\]\\(\\)\\~\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!"},
+		{"reserved in text", "a.b! c-d (e) {f} #g +h =i |j >k", "a\\.b\\! c\\-d \\(e\\) \\{f\\} \\#g \\+h \\=i \\|j \\>k"},
+		{"already escaped", "already \\. escaped", "already \\. escaped"},
+		{"nested", "**bold _italic_ bold**", "*bold _italic_ bold*"},
+		{"unclosed bold", "**unclosed", "\\*\\*unclosed"},
+		{"unclosed italic", "_unclosed", "\\_unclosed"},
+		{"unclosed code", "`unclosed", "\\`unclosed"},
+		{"unclosed link", "[text](unclosed", "\\[text\\]\\(unclosed"},
+		{"brackets without target", "[no url]", "\\[no url\\]"},
+		{"spaced asterisks", "a * b * c", "a \\* b \\* c"},
+		{"snake_case", "snake_case_name", "snake\\_case\\_name"},
+		{"heading", "# Heading.", "*Heading\\.*"},
+		{"bullet", "- item", "• item"},
+		{"task", "- [x] done", "☑ done"},
+		{"ordered", "1. one", "1\\. one"},
+		{"quote", "> quote", ">quote"},
+		{"table", "| a | b |\n|---|---|\n| 1 | 2 |", "a \\| b\n1 \\| 2"},
+		{"rule", "---", "──────────"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := markdownToV2(tc.in); got != tc.want {
+				t.Errorf("markdownToV2(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSendMessageFormattedTextOnlyOnSuccess(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	args := map[string]any{"token": "1:T", "chatID": "1", "text": "**hi**", "formatMarkdown": true}
+
+	if data := call(t, p, "SendMessage", args); data["formattedText"] != "*hi*" {
+		t.Errorf("formattedText = %v, want *hi*", data["formattedText"])
+	}
+
+	stub.errorCode.Store(400)
+	res := callRaw(t, p, "SendMessage", args)
+	if data, _ := res.Data.(map[string]any); res.Success || data["formattedText"] != nil {
+		t.Errorf("failed send: Success=%v formattedText=%v", res.Success, data["formattedText"])
+	}
+}
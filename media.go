@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+var mediaGroupTypes = map[string]bool{
+	"photo":    true,
+	"video":    true,
+	"audio":    true,
+	"document": true,
+}
+
+// handleSendMediaGroup sends 2-10 photos, videos, audios or documents as a
+// single album. Each item references its media by URL/file_id or carries
+// the bytes to upload, which are attached as multipart parts.
+func (t *TelegramPlugin) handleSendMediaGroup(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	items, err := mapsArg(args, "media")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || items == nil {
+		return invalidArgs("token, chatID and media are required")
+	}
+	if len(items) < 2 || len(items) > 10 {
+		return invalidArgs("media must contain between 2 and 10 items, got %d", len(items))
+	}
+
+	var files []upload
+	media := make([]map[string]any, 0, len(items))
+	for i, item := range items {
+		typ, _ := item["type"].(string)
+		if !mediaGroupTypes[typ] {
+			return invalidArgs("media[%d]: type must be one of photo, video, audio or document", i)
+		}
+		entry := map[string]any{"type": typ}
+
+		ref, _ := item["media"].(string)
+		filePath, _ := item["filePath"].(string)
+		set := 0
+		for _, ok := range []bool{ref != "", item["data"] != nil, filePath != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set > 1 {
+			return invalidArgs("media[%d]: only one of media, data and filePath may be set", i)
+		}
+		field := fmt.Sprintf("file%d", i)
+		filename, _ := item["filename"].(string)
+		switch {
+		case filePath != "":
+			data, err := readLocalFile(filePath)
+			if err != nil {
+				return fail(fmt.Errorf("media[%d]: %w", i, err))
+			}
+			if filename == "" {
+				filename = filepath.Base(filePath)
+			}
+			files = append(files, upload{field: field, filename: filename, data: data})
+			entry["media"] = "attach://" + field
+		case item["data"] != nil:
+			data, err := bytesValue(item["data"])
+			if err != nil {
+				return invalidArgs("media[%d]: %v", i, err)
+			}
+			if filename == "" {
+				filename = field
+			}
+			files = append(files, upload{field: field, filename: filename, data: data})
+			entry["media"] = "attach://" + field
+		case ref != "":
+			entry["media"] = ref
+		default:
+			return invalidArgs("media[%d]: either media, data or filePath is required", i)
+		}
+
+		if caption, _ := item["caption"].(string); caption != "" {
+			entry["caption"] = caption
+		}
+		if parseMode, _ := item["parseMode"].(string); parseMode != "" {
+			entry["parse_mode"] = parseMode
+		}
+		media = append(media, entry)
+	}
+
+	encoded, err := json.Marshal(media)
+	if err != nil {
+		return fail(err)
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("media", string(encoded))
+	if err := setDeliveryOptions(args, form); err != nil {
+		return fail(err)
+	}
+
+	var sent []message
+	if err := uploadTelegram(ctx, token, "sendMediaGroup", form, files, &sent); err != nil {
+		return fail(err)
+	}
+
+	ids := make([]string, len(sent))
+	for i, m := range sent {
+		ids[i] = strconv.FormatInt(m.MessageID, 10)
+	}
+	return succeed(map[string]any{"messageIDs": ids})
+}
+
+// Bots can only download files up to 20 MB through the Bot API.
+const defaultMaxFileBytes = 20 << 20
+
+// handleGetFile resolves a file_id with getFile and downloads its contents,
+// returned base64-encoded.
+func (t *TelegramPlugin) handleGetFile(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	fileID, _ := args["fileID"].(string)
+	maxBytes, ok, err := intArg(args, "maxBytes")
+	if err != nil {
+		return fail(err)
+	}
+	if !ok {
+		maxBytes = defaultMaxFileBytes
+	}
+
+	if token == "" || fileID == "" {
+		return invalidArgs("token and fileID are required")
+	}
+	if maxBytes <= 0 {
+		return invalidArgs("maxBytes must be positive")
+	}
+
+	form := url.Values{}
+	form.Set("file_id", fileID)
+
+	var file struct {
+		FileSize int64  `json:"file_size"`
+		FilePath string `json:"file_path"`
+	}
+	if err := callTelegram(ctx, token, "getFile", form, &file); err != nil {
+		return fail(err)
+	}
+	if file.FilePath == "" {
+		return fail(fmt.Errorf("telegram did not return a download path for file %s", fileID))
+	}
+	if file.FileSize > maxBytes {
+		return fail(fmt.Errorf("file is %d bytes, exceeds maxBytes %d: %w", file.FileSize, maxBytes, errTooLarge))
+	}
+
+	data, err := downloadFile(ctx, token, file.FilePath, maxBytes)
+	if err != nil {
+		return fail(err)
+	}
+
+	return succeed(map[string]any{
+		"data":     base64.StdEncoding.EncodeToString(data),
+		"mimeType": http.DetectContentType(data),
+		"size":     int64(len(data)),
+		"filePath": file.FilePath,
+	})
+}
+
+const (
+	// Bots may upload files up to 50 MB; thumbnails are limited to 200 kB.
+	maxUploadBytes    = 50 << 20
+	maxThumbnailBytes = 200 << 10
+)
+
+// fileRef is the part of Telegram's PhotoSize, Video, Audio, etc. objects
+// callers need to reuse a file.
+type fileRef struct {
+	FileID string `json:"file_id"`
+}
+
+// mediaMessage is a sent message carrying a file of one of these kinds.
+type mediaMessage struct {
+	MessageID int64     `json:"message_id"`
+	Photo     []fileRef `json:"photo"`
+	Video     *fileRef  `json:"video"`
+	Audio     *fileRef  `json:"audio"`
+	Document  *fileRef  `json:"document"`
+	Voice     *fileRef  `json:"voice"`
+	Sticker   *fileRef  `json:"sticker"`
+}
+
+// fileID returns the file_id of the message's file; for photos that is the
+// largest size.
+func (m *mediaMessage) fileID() string {
+	switch {
+	case len(m.Photo) > 0:
+		return m.Photo[len(m.Photo)-1].FileID
+	case m.Video != nil:
+		return m.Video.FileID
+	case m.Audio != nil:
+		return m.Audio.FileID
+	case m.Document != nil:
+		return m.Document.FileID
+	case m.Voice != nil:
+		return m.Voice.FileID
+	case m.Sticker != nil:
+		return m.Sticker.FileID
+	}
+	return ""
+}
+
+// maxCaptionLength is Telegram's limit for media captions, in UTF-16 code
+// units.
+const maxCaptionLength = 1024
+
+// mediaSend is a validated send<Media> request.
+type mediaSend struct {
+	form  url.Values
+	files []upload
+	// followUps is the part of an over-long caption that is sent as text
+	// messages after the media, for captionOverflow "split".
+	followUps []string
+}
+
+// mediaRequest builds the parts shared by the send<Media> methods: the
+// chat, the media itself, its caption and an optional thumbnail. The media
+// is either a URL or file_id in args[field], bytes (raw or base64) in
+// args["data"] that are uploaded as a multipart file named by filename, or,
+// with --allow-local-files, a file read from args["filePath"].
+func mediaRequest(args map[string]any, field string) (*mediaSend, error) {
+	chatID, _ := args["chatID"].(string)
+	ref, _ := args[field].(string)
+	if chatID == "" {
+		return nil, argErrorf("chatID is required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	var files []upload
+
+	filePath, _ := args["filePath"].(string)
+	sources := 0
+	for _, set := range []bool{ref != "", args["data"] != nil, filePath != ""} {
+		if set {
+			sources++
+		}
+	}
+
+	switch {
+	case sources > 1:
+		return nil, argErrorf("only one of %s, data and filePath may be set", field)
+	case filePath != "":
+		data, err := readLocalFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		filename, _ := args["filename"].(string)
+		if filename == "" {
+			filename = filepath.Base(filePath)
+		}
+		files = append(files, upload{field: field, filename: filename, data: data})
+	case args["data"] != nil:
+		data, err := bytesValue(args["data"])
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxUploadBytes {
+			return nil, fmt.Errorf("%s is %d bytes, uploads are limited to %d: %w", field, len(data), maxUploadBytes, errTooLarge)
+		}
+		filename, _ := args["filename"].(string)
+		if filename == "" {
+			filename = field
+		}
+		files = append(files, upload{field: field, filename: filename, data: data})
+	case ref != "":
+		form.Set(field, ref)
+	default:
+		return nil, argErrorf("either %s (URL or file_id), data or filePath is required", field)
+	}
+
+	req := &mediaSend{form: form}
+	caption, _ := args["caption"].(string)
+	if err := req.setCaption(caption, args); err != nil {
+		return nil, err
+	}
+	if parseMode, _ := args["parseMode"].(string); parseMode != "" {
+		form.Set("parse_mode", parseMode)
+	}
+	if err := setDeliveryOptions(args, form); err != nil {
+		return nil, err
+	}
+
+	if args["thumbnail"] != nil {
+		thumb, err := bytesValue(args["thumbnail"])
+		if err != nil {
+			return nil, argErrorf("thumbnail: %v", err)
+		}
+		if len(thumb) > maxThumbnailBytes {
+			return nil, fmt.Errorf("thumbnail is %d bytes, limited to %d: %w", len(thumb), maxThumbnailBytes, errTooLarge)
+		}
+		files = append(files, upload{field: "thumbnail", filename: "thumbnail.jpg", data: thumb})
+	}
+
+	req.files = files
+	return req, nil
+}
+
+// setCaption sets the caption, handling one over maxCaptionLength as
+// args["captionOverflow"] asks: "error" (the default) rejects it,
+// "truncate" cuts it with an ellipsis and "split" sends the rest as
+// follow-up messages.
+func (m *mediaSend) setCaption(caption string, args map[string]any) error {
+	overflow, _ := args["captionOverflow"].(string)
+	if overflow == "" {
+		overflow = "error"
+	}
+	if overflow != "error" && overflow != "truncate" && overflow != "split" {
+		return argErrorf("captionOverflow must be error, truncate or split")
+	}
+	if caption == "" {
+		return nil
+	}
+
+	if utf16Len(caption) > maxCaptionLength {
+		switch overflow {
+		case "error":
+			return argErrorf("caption exceeds %d characters; set captionOverflow to truncate or split", maxCaptionLength)
+		case "truncate":
+			caption = caption[:utf16Prefix(caption, maxCaptionLength-1)] + "…"
+		case "split":
+			first, rest := cutMessage(caption, maxCaptionLength)
+			if first == "" {
+				return argErrorf("caption must not be only whitespace")
+			}
+			m.followUps = splitMessage(strings.TrimSpace(rest), maxMessageLength)
+			caption = first
+		}
+	}
+	m.form.Set("caption", caption)
+	return nil
+}
+
+// setIntFields copies the given optional integer args to their form fields.
+func setIntFields(args map[string]any, form url.Values, fields map[string]string) error {
+	for arg, field := range fields {
+		v, ok, err := intArg(args, arg)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if v < 0 {
+				return argErrorf("%s must not be negative", arg)
+			}
+			form.Set(field, strconv.FormatInt(v, 10))
+		}
+	}
+	return nil
+}
+
+// sendMedia performs a send<Media> call and reports the new message and
+// the file_id Telegram assigned, which can be reused to send it again.
+// Caption follow-ups are sent after it with the same parse mode and content
+// protection, and every message ID is listed in messageIDs.
+func sendMedia(ctx context.Context, token, method string, req *mediaSend) sdk.Response {
+	var sent mediaMessage
+	if err := uploadTelegram(ctx, token, method, req.form, req.files, &sent); err != nil {
+		return fail(err)
+	}
+	messageID := strconv.FormatInt(sent.MessageID, 10)
+	data := map[string]any{"messageID": messageID, "fileID": sent.fileID()}
+	if len(req.followUps) == 0 {
+		return succeed(data)
+	}
+
+	opts := url.Values{}
+	for _, field := range []string{"parse_mode", "protect_content"} {
+		if v := req.form.Get(field); v != "" {
+			opts.Set(field, v)
+		}
+	}
+	ids := []string{messageID}
+	for _, part := range req.followUps {
+		sent, err := sendTelegramMessage(ctx, token, req.form.Get("chat_id"), part, opts)
+		if err != nil {
+			res := fail(err)
+			// Report what did go out so the caller can clean up.
+			res.Data.(map[string]any)["messageIDs"] = ids
+			return res
+		}
+		ids = append(ids, strconv.FormatInt(sent.MessageID, 10))
+	}
+	data["messageIDs"] = ids
+	return succeed(data)
+}
+
+// handleSendVideo sends an MPEG4 video.
+func (t *TelegramPlugin) handleSendVideo(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	req, err := mediaRequest(args, "video")
+	if err != nil {
+		return fail(err)
+	}
+	if err := setIntFields(args, req.form, map[string]string{
+		"duration": "duration",
+		"width":    "width",
+		"height":   "height",
+	}); err != nil {
+		return fail(err)
+	}
+	streaming, hasStreaming, err := boolArg(args, "supportsStreaming")
+	if err != nil {
+		return fail(err)
+	}
+	if hasStreaming {
+		req.form.Set("supports_streaming", strconv.FormatBool(streaming))
+	}
+
+	return sendMedia(ctx, token, "sendVideo", req)
+}
+
+// handleSendAudio sends an audio file that Telegram shows in its music
+// player.
+func (t *TelegramPlugin) handleSendAudio(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	req, err := mediaRequest(args, "audio")
+	if err != nil {
+		return fail(err)
+	}
+	if err := setIntFields(args, req.form, map[string]string{"duration": "duration"}); err != nil {
+		return fail(err)
+	}
+	if performer, _ := args["performer"].(string); performer != "" {
+		req.form.Set("performer", performer)
+	}
+	if title, _ := args["title"].(string); title != "" {
+		req.form.Set("title", title)
+	}
+
+	return sendMedia(ctx, token, "sendAudio", req)
+}
+
+// handleSendPhoto sends a photo, which Telegram recompresses for display.
+func (t *TelegramPlugin) handleSendPhoto(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	req, err := mediaRequest(args, "photo")
+	if err != nil {
+		return fail(err)
+	}
+	return sendMedia(ctx, token, "sendPhoto", req)
+}
+
+// handleSendDocument sends a file as is, for the user to download.
+func (t *TelegramPlugin) handleSendDocument(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	req, err := mediaRequest(args, "document")
+	if err != nil {
+		return fail(err)
+	}
+	disable, hasDisable, err := boolArg(args, "disableContentTypeDetection")
+	if err != nil {
+		return fail(err)
+	}
+	if hasDisable {
+		req.form.Set("disable_content_type_detection", strconv.FormatBool(disable))
+	}
+	return sendMedia(ctx, token, "sendDocument", req)
+}
+
+// handleSendVoice sends a voice note. Telegram only plays OGG files encoded
+// with Opus as voice notes, so uploaded data is checked for that first: a
+// mismatch fails the call with strict set and is otherwise reported in
+// warning.
+func (t *TelegramPlugin) handleSendVoice(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	strict, _, err := boolArg(args, "strict")
+	if err != nil {
+		return fail(err)
+	}
+	// voiceData is another name for data, for callers that name the bytes
+	// after the media.
+	if v := args["voiceData"]; v != nil {
+		if args["data"] != nil {
+			return invalidArgs("only one of data and voiceData may be set")
+		}
+		withData := make(map[string]any, len(args))
+		for k, val := range args {
+			withData[k] = val
+		}
+		withData["data"] = v
+		args = withData
+	}
+	req, err := mediaRequest(args, "voice")
+	if err != nil {
+		return fail(err)
+	}
+	if err := setIntFields(args, req.form, map[string]string{"duration": "duration"}); err != nil {
+		return fail(err)
+	}
+
+	var warning string
+	for _, f := range req.files {
+		if f.field == "voice" && !isOggOpus(f.data) {
+			warning = "voice data is not OGG/Opus; Telegram may not play it as a voice note"
+		}
+	}
+	if warning != "" && strict {
+		return invalidArgs("%s", warning)
+	}
+
+	res := sendMedia(ctx, token, "sendVoice", req)
+	if data, ok := res.Data.(map[string]any); ok && res.Success && warning != "" {
+		logger.Warn(warning, callAttrs(ctx)...)
+		data["warning"] = warning
+	}
+	return res
+}
+
+// isOggOpus reports whether data starts with an OGG page whose first packet
+// is an Opus identification header.
+func isOggOpus(data []byte) bool {
+	const pageHeader = 27
+	if len(data) < pageHeader || string(data[:4]) != "OggS" {
+		return false
+	}
+	packet := pageHeader + int(data[26])
+	return len(data) >= packet+8 && string(data[packet:packet+8]) == "OpusHead"
+}
+
+// handleSendSticker sends a sticker by file_id or URL, or uploads a .webp,
+// .tgs or .webm file. emoji is only used for uploads.
+func (t *TelegramPlugin) handleSendSticker(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	req, err := mediaRequest(args, "sticker")
+	if err != nil {
+		return fail(err)
+	}
+	if emoji, _ := args["emoji"].(string); emoji != "" {
+		req.form.Set("emoji", emoji)
+	}
+	return sendMedia(ctx, token, "sendSticker", req)
+}
+
+// handleGetStickerSet lists the stickers of a set with the file_ids
+// SendSticker takes.
+func (t *TelegramPlugin) handleGetStickerSet(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	name, _ := args["name"].(string)
+	if token == "" || name == "" {
+		return invalidArgs("token and name are required")
+	}
+
+	form := url.Values{}
+	form.Set("name", name)
+
+	var set struct {
+		Name        string `json:"name"`
+		Title       string `json:"title"`
+		StickerType string `json:"sticker_type"`
+		Stickers    []struct {
+			FileID       string `json:"file_id"`
+			FileUniqueID string `json:"file_unique_id"`
+			Emoji        string `json:"emoji"`
+			IsAnimated   bool   `json:"is_animated"`
+			IsVideo      bool   `json:"is_video"`
+		} `json:"stickers"`
+	}
+	if err := callTelegram(ctx, token, "getStickerSet", form, &set); err != nil {
+		return fail(err)
+	}
+
+	stickers := make([]any, 0, len(set.Stickers))
+	for _, st := range set.Stickers {
+		stickers = append(stickers, map[string]any{
+			"fileID":       st.FileID,
+			"fileUniqueID": st.FileUniqueID,
+			"emoji":        st.Emoji,
+			"isAnimated":   st.IsAnimated,
+			"isVideo":      st.IsVideo,
+		})
+	}
+	return succeed(map[string]any{
+		"name":        set.Name,
+		"title":       set.Title,
+		"stickerType": set.StickerType,
+		"stickers":    stickers,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSetCaptionSplit(t *testing.T) {
+	word := strings.Repeat("a", 100)
+	for _, tc := range []struct {
+		name    string
+		caption string
+		want    string // caption and follow-ups joined with |
+		wantErr bool
+	}{
+		{"fits", "short", "short", false},
+		{"split at spaces", strings.Repeat(word+" ", 12), strings.TrimSpace(strings.Repeat(word+" ", 10)) + "|" + word + " " + word, false},
+		// The whitespace-only leading part is dropped, and neither repeated
+		// nor lost in the follow-ups.
+		{"leading whitespace", strings.Repeat(" ", maxCaptionLength+10) + "tail", "tail", false},
+		{"all whitespace", strings.Repeat(" ", maxCaptionLength+1), "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &mediaSend{form: url.Values{}}
+			err := m.setCaption(tc.caption, map[string]any{"captionOverflow": "split"})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := utf16Len(m.form.Get("caption")); n > maxCaptionLength {
+				t.Errorf("caption is %d units", n)
+			}
+			got := strings.Join(append([]string{strings.TrimSpace(m.form.Get("caption"))}, m.followUps...), "|")
+			if got != tc.want {
+				t.Errorf("caption and follow-ups = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// oggPage builds the start of an Ogg page whose first packet is packet.
+func oggPage(packet string) []byte {
+	page := []byte("OggS")
+	page = append(page, 0, 2)                // version, beginning of stream
+	page = append(page, make([]byte, 20)...) // granule, serial, sequence, CRC
+	page = append(page, 1, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func TestIsOggOpus(t *testing.T) {
+	opus := oggPage("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"opus", opus, true},
+		{"vorbis", oggPage("\x01vorbis\x00\x00\x00\x00\x02"), false},
+		{"flac in ogg", oggPage("\x7fFLAC\x01\x00"), false},
+		{"not ogg", append([]byte("ID3\x04"), opus[4:]...), false},
+		{"empty", nil, false},
+		{"truncated page header", opus[:20], false},
+		{"truncated segment table", opus[:27], false},
+		{"truncated packet", opus[:27+1+5], false},
+		// A segment count pointing past the end of the data.
+		{"bad segment count", append(append([]byte{}, opus[:26]...), 255), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isOggOpus(tc.data); got != tc.want {
+				t.Errorf("isOggOpus = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSendVoiceChecksOpus(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	opus := oggPage("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	vorbis := oggPage("\x01vorbis\x00\x00\x00\x00\x02")
+	args := func(data []byte, strict bool) map[string]any {
+		return map[string]any{"token": "1:T", "chatID": "1", "data": data, "strict": strict}
+	}
+
+	if data := call(t, p, "SendVoice", args(opus, true)); data["warning"] != nil {
+		t.Errorf("warning = %v for OGG/Opus", data["warning"])
+	}
+	if data := call(t, p, "SendVoice", args(vorbis, false)); data["warning"] == nil {
+		t.Error("no warning for OGG/Vorbis")
+	}
+	res := callRaw(t, p, "SendVoice", args(vorbis, true))
+	if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+		t.Errorf("strict OGG/Vorbis: Success=%v errorCode=%v, want INVALID_ARGS", res.Success, data["errorCode"])
+	}
+	if got := stub.count("sendVoice"); got != 2 {
+		t.Errorf("sendVoice called %d times, want 2", got)
+	}
+}
@@ -0,0 +1,1177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// maxMessageLength is Telegram's limit for message text, counted in UTF-16
+// code units.
+const maxMessageLength = 4096
+
+// maxFanout bounds how many chats a multi-chat SendMessage sends to at once.
+const maxFanout = 5
+
+// handleSendMessage sends a text message. Text over the length limit is
+// rejected up front unless autoSplit is set, in which case it is sent as
+// several consecutive messages. With idempotencyKey, a repeated call for the
+// same chat and key within the TTL returns the original message IDs with
+// deduplicated=true instead of sending again.
+//
+// chatID may also be an array, in which case the message is sent to every
+// chat concurrently and each chat's outcome is reported in results.
+//
+// With scheduleAt the message is validated now but sent later, and the call
+// returns a scheduledID instead of message IDs.
+//
+// With confirmDelivery, a reply without a message_id or with an implausible
+// date fails the call instead of counting as sent, and the result carries
+// the send time and, for chats that have one, a t.me link to the message.
+func (t *TelegramPlugin) handleSendMessage(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	text, _ := args["text"].(string)
+	key, _ := args["idempotencyKey"].(string)
+	autoSplit, _, err := boolArg(args, "autoSplit")
+	if err != nil {
+		return fail(err)
+	}
+	formatMarkdown, _, err := boolArg(args, "formatMarkdown")
+	if err != nil {
+		return fail(err)
+	}
+	confirm, _, err := boolArg(args, "confirmDelivery")
+	if err != nil {
+		return fail(err)
+	}
+	var at time.Time
+	if scheduleAt, _ := args["scheduleAt"].(string); scheduleAt != "" {
+		if at, err = time.Parse(time.RFC3339, scheduleAt); err != nil {
+			return invalidArgs("scheduleAt must be an RFC 3339 timestamp")
+		}
+		if !at.After(time.Now()) {
+			return invalidArgs("scheduleAt must be in the future")
+		}
+	}
+
+	chatID, _ := args["chatID"].(string)
+	var chatIDs []string
+	if _, ok := args["chatID"].(string); !ok && args["chatID"] != nil {
+		if chatIDs, err = stringsArg(args, "chatID"); err != nil {
+			return invalidArgs("chatID must be a string or an array of strings")
+		}
+		if len(chatIDs) == 0 {
+			return invalidArgs("chatID must not be an empty array")
+		}
+		chatID = chatIDs[0]
+	}
+
+	if token == "" || chatID == "" || text == "" {
+		return invalidArgs("token, chatID and text are required")
+	}
+
+	opts, err := sendMessageOptions(args)
+	if err != nil {
+		return fail(err)
+	}
+	entities, hasEntities, err := entitiesArg(args, text)
+	if err != nil {
+		return fail(err)
+	}
+	if hasEntities {
+		if opts.Get("parse_mode") != "" || formatMarkdown {
+			return invalidArgs("entities cannot be combined with parseMode or formatMarkdown")
+		}
+		if utf16Len(text) > maxMessageLength {
+			return invalidArgs("text with entities must fit in one message of %d characters", maxMessageLength)
+		}
+		opts.Set("entities", entities)
+	}
+	if formatMarkdown {
+		if mode := opts.Get("parse_mode"); mode != "" && mode != "MarkdownV2" {
+			return invalidArgs("formatMarkdown sends MarkdownV2 and cannot be combined with parseMode %s", mode)
+		}
+		opts.Set("parse_mode", "MarkdownV2")
+	}
+
+	// Length is checked, and text split, before formatting: Telegram counts
+	// characters after parsing the markup, and splitting the source keeps
+	// the cuts out of escape sequences.
+	parts := []string{text}
+	if utf16Len(text) > maxMessageLength {
+		if !autoSplit {
+			return invalidArgs("text exceeds %d characters", maxMessageLength)
+		}
+		parts = splitMessage(text, maxMessageLength)
+		if len(parts) == 0 {
+			return invalidArgs("text must not be only whitespace")
+		}
+	}
+	if formatMarkdown {
+		for i, part := range parts {
+			parts[i] = markdownToV2(part)
+		}
+	}
+
+	msg := &textMessage{sent: t.state.sent, chats: t.state.chats, spool: t.state.spool, token: token, parts: parts, opts: opts, key: key, autoSplit: autoSplit, confirm: confirm}
+	send := func(ctx context.Context) sdk.Response {
+		if chatIDs == nil {
+			return msg.deliver(ctx, chatID)
+		}
+		return msg.fanOut(ctx, chatIDs)
+	}
+	var res sdk.Response
+	if at.IsZero() {
+		res = send(ctx)
+	} else {
+		res = t.state.scheduled.schedule(ctx, token, at, send)
+	}
+	if data, ok := res.Data.(map[string]any); ok && res.Success && formatMarkdown {
+		data["formattedText"] = strings.Join(parts, "\n")
+	}
+	return res
+}
+
+// textMessage is a validated SendMessage request, ready to be delivered to
+// one or more chats.
+type textMessage struct {
+	sent      *idempotencyCache
+	chats     *chatCache
+	spool     *spool
+	token     string
+	parts     []string
+	opts      url.Values
+	key       string
+	autoSplit bool
+	confirm   bool
+}
+
+// deliver sends the message to one chat. An @username Telegram reports as
+// not found is resolved with getChat and the send retried with the numeric
+// ID, which is then used for that username from the start.
+func (m *textMessage) deliver(ctx context.Context, chatID string) sdk.Response {
+	target := m.chats.lookup(chatID)
+	sendPart := func(text string, opts url.Values) (message, error) {
+		sent, err := sendTelegramMessage(ctx, m.token, target, text, opts)
+		if err == nil || target != chatID || !strings.HasPrefix(chatID, "@") || !chatNotFound(err) {
+			return sent, err
+		}
+		id, rerr := m.chats.resolve(ctx, m.token, chatID)
+		if rerr != nil {
+			return sent, err
+		}
+		target = id
+		return sendTelegramMessage(ctx, m.token, target, text, opts)
+	}
+
+	var first message
+	send := func() ([]string, error) {
+		ids := make([]string, 0, len(m.parts))
+		opts := m.opts
+		for i, part := range m.parts {
+			if i == 1 && opts.Has("message_effect_id") {
+				// The effect plays once, on the first part.
+				opts = url.Values{}
+				for k, v := range m.opts {
+					opts[k] = v
+				}
+				opts.Del("message_effect_id")
+			}
+			sent, err := sendPart(part, opts)
+			if err == nil && m.confirm {
+				err = confirmSent(sent)
+			}
+			if err != nil {
+				return ids, err
+			}
+			if i == 0 {
+				first = sent
+			}
+			ids = append(ids, strconv.FormatInt(sent.MessageID, 10))
+		}
+		return ids, nil
+	}
+
+	if m.spool != nil && m.key != "" && m.spool.has(spoolID(chatID, m.key)) {
+		// An earlier call with this key is waiting in the spool.
+		return succeed(map[string]any{"spooled": true, "spoolID": spoolID(chatID, m.key), "deduplicated": true})
+	}
+
+	var ids []string
+	var deduplicated bool
+	var err error
+	if m.key == "" {
+		ids, err = send()
+	} else {
+		ids, deduplicated, err = m.sent.do(chatID+"\x00"+m.key, send)
+	}
+	if err != nil && m.spool != nil && transientError(err) {
+		if res, ok := m.spoolRest(target, chatID, ids, err); ok {
+			return res
+		}
+	}
+	if err != nil {
+		res := fail(err)
+		if len(ids) > 0 {
+			// Report the parts that did go out so the caller can clean up.
+			res.Data.(map[string]any)["messageIDs"] = ids
+		}
+		return res
+	}
+
+	data := map[string]any{"messageID": ids[0]}
+	if m.autoSplit {
+		data["messageIDs"] = ids
+	}
+	if m.key != "" {
+		data["deduplicated"] = deduplicated
+	}
+	if target != chatID {
+		data["resolvedChatID"] = target
+	}
+	// A deduplicated send only has the recorded IDs to report.
+	if m.confirm && !deduplicated {
+		data["sentAt"] = time.Unix(first.Date, 0).UTC().Format(time.RFC3339)
+		if link := messageLink(first); link != "" {
+			data["link"] = link
+		}
+	}
+	return succeed(data)
+}
+
+// spoolRest stores the parts a transient failure kept from being sent, and
+// reports the send as spooled. It reports false when the spool could not
+// take them, leaving the failure to the caller.
+func (m *textMessage) spoolRest(target, chatID string, sentIDs []string, sendErr error) (sdk.Response, bool) {
+	opts := url.Values{}
+	for k, v := range m.opts {
+		opts[k] = v
+	}
+	if len(sentIDs) > 0 {
+		opts.Del("message_effect_id")
+	}
+	entry := &spooledMessage{
+		ID:        spoolID(chatID, m.key),
+		Token:     m.token,
+		ChatID:    target,
+		Parts:     m.parts[len(sentIDs):],
+		Options:   opts,
+		SentIDs:   sentIDs,
+		Created:   time.Now(),
+		LastError: sendErr.Error(),
+	}
+	if m.key != "" {
+		entry.CacheKey = chatID + "\x00" + m.key
+	}
+	if _, err := m.spool.add(entry); err != nil {
+		logger.Error("failed to spool message", "error", err.Error())
+		return sdk.Response{}, false
+	}
+
+	data := map[string]any{"spooled": true, "spoolID": entry.ID}
+	if len(sentIDs) > 0 {
+		data["messageIDs"] = sentIDs
+	}
+	return succeed(data), true
+}
+
+// deliveryClockSkew is how far from now confirmDelivery accepts the date
+// Telegram reports for a sent message.
+const deliveryClockSkew = 5 * time.Minute
+
+// confirmSent checks that a sendMessage result describes a message that was
+// actually posted.
+func confirmSent(m message) error {
+	if m.MessageID <= 0 {
+		return fmt.Errorf("sendMessage returned no message_id: %w", errUnconfirmed)
+	}
+	if m.Date == 0 {
+		return fmt.Errorf("sendMessage returned no date: %w", errUnconfirmed)
+	}
+	if d := time.Since(time.Unix(m.Date, 0)); d > deliveryClockSkew || d < -deliveryClockSkew {
+		return fmt.Errorf("sendMessage returned implausible date %s: %w", time.Unix(m.Date, 0).UTC().Format(time.RFC3339), errUnconfirmed)
+	}
+	return nil
+}
+
+// messageLink returns the t.me link to a message in a public chat, or in a
+// supergroup or channel for its members. Private chats and basic groups
+// have no message links.
+func messageLink(m message) string {
+	const channelPrefix = -1000000000000
+	switch {
+	case m.Chat.Username != "":
+		return fmt.Sprintf("https://t.me/%s/%d", m.Chat.Username, m.MessageID)
+	case m.Chat.ID < channelPrefix:
+		return fmt.Sprintf("https://t.me/c/%d/%d", channelPrefix-m.Chat.ID, m.MessageID)
+	}
+	return ""
+}
+
+// fanOut delivers the message to every chat, at most maxFanout at a time.
+// One chat failing does not stop the others; the call only fails when no
+// chat received the message.
+func (m *textMessage) fanOut(ctx context.Context, chatIDs []string) sdk.Response {
+	results := make([]any, len(chatIDs))
+	sem := make(chan struct{}, maxFanout)
+	var wg sync.WaitGroup
+	for i, chatID := range chatIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+
+			res := m.deliver(ctx, chatID)
+			result := map[string]any{"chatID": chatID, "success": res.Success}
+			if data, ok := res.Data.(map[string]any); ok {
+				for k, v := range data {
+					result[k] = v
+				}
+			}
+			if !res.Success {
+				result["error"] = res.Error
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if !r.(map[string]any)["success"].(bool) {
+			failed++
+		}
+	}
+
+	data := map[string]any{"results": results, "sent": len(chatIDs) - failed, "failed": failed}
+	if failed == len(chatIDs) {
+		data["errorCode"] = results[0].(map[string]any)["errorCode"]
+		return sdk.Response{Success: false, Error: fmt.Sprintf("sending to all %d chats failed", failed), Data: data}
+	}
+	return succeed(data)
+}
+
+func sendTelegramMessage(ctx context.Context, token, chatID, text string, opts url.Values) (message, error) {
+	data := url.Values{}
+	for key, values := range opts {
+		data[key] = values
+	}
+	data.Set("chat_id", chatID)
+	data.Set("text", text)
+
+	var sent message
+	err := callTelegram(ctx, token, "sendMessage", data, &sent)
+	return sent, err
+}
+
+// utf16Len returns the length of s in UTF-16 code units, which is how
+// Telegram measures text.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// utf16Prefix returns the byte length of the longest prefix of s that fits
+// in limit UTF-16 code units without splitting a rune.
+func utf16Prefix(s string, limit int) int {
+	n := 0
+	for i, r := range s {
+		w := 1
+		if r >= 0x10000 {
+			w = 2
+		}
+		if n+w > limit {
+			return i
+		}
+		n += w
+	}
+	return len(s)
+}
+
+// splitMessage breaks text into parts of at most limit UTF-16 code units.
+// It cuts at the last paragraph break, line break or space that keeps the
+// part at least half full, and only splits mid-word when there is none.
+// Whitespace-only parts are dropped, so all-whitespace text has none.
+// Formatting markup that spans a cut is not repaired.
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	for text != "" {
+		var part string
+		part, text = cutMessage(text, limit)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// cutMessage returns the first part splitMessage would make of text and the
+// text left after it. part is empty when all of text is whitespace.
+func cutMessage(text string, limit int) (part, rest string) {
+	for utf16Len(text) > limit {
+		cut := utf16Prefix(text, limit)
+		at, skip := cut, 0
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(text[:cut], sep); i > cut/2 {
+				at, skip = i, len(sep)
+				break
+			}
+		}
+		if part := text[:at]; strings.TrimSpace(part) != "" {
+			return part, text[at+skip:]
+		}
+		text = text[at+skip:]
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", ""
+	}
+	return text, ""
+}
+
+// sendMessageOptions maps the optional SendMessage arguments to their
+// sendMessage form fields. Fields are only set when the caller provided them
+// so Telegram's own defaults apply otherwise.
+func sendMessageOptions(args map[string]any) (url.Values, error) {
+	opts := url.Values{}
+
+	if parseMode, _ := args["parseMode"].(string); parseMode != "" {
+		opts.Set("parse_mode", parseMode)
+	}
+
+	for _, f := range []struct{ arg, field string }{
+		{"replyToMessageID", "reply_to_message_id"},
+		{"messageThreadID", "message_thread_id"},
+	} {
+		v, ok, err := intArg(args, f.arg)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			opts.Set(f.field, strconv.FormatInt(v, 10))
+		}
+	}
+
+	// disable_web_page_preview is independent of parse_mode, so suppressing
+	// link previews works the same for plain, HTML and Markdown text.
+	for _, f := range []struct{ arg, field string }{
+		{"disableNotification", "disable_notification"},
+		{"disableWebPagePreview", "disable_web_page_preview"},
+	} {
+		v, ok, err := boolArg(args, f.arg)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			opts.Set(f.field, strconv.FormatBool(v))
+		}
+	}
+
+	// With both, disableWebPagePreview fills in is_disabled, and an
+	// is_disabled in linkPreviewOptions wins. Telegram gets one of the two.
+	if args["linkPreviewOptions"] != nil {
+		disabled, _ := strconv.ParseBool(opts.Get("disable_web_page_preview"))
+		opts.Del("disable_web_page_preview")
+		preview, err := linkPreviewArg(args, disabled)
+		if err != nil {
+			return nil, err
+		}
+		opts.Set("link_preview_options", preview)
+	}
+
+	if err := setDeliveryOptions(args, opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// linkPreviewFields are the LinkPreviewOptions fields, with their JSON kind.
+var linkPreviewFields = map[string]string{
+	"is_disabled":        "boolean",
+	"url":                "string",
+	"prefer_small_media": "boolean",
+	"prefer_large_media": "boolean",
+	"show_above_text":    "boolean",
+}
+
+// linkPreviewArg validates args["linkPreviewOptions"], a LinkPreviewOptions
+// object with Telegram's field names, and returns it JSON encoded. disabled
+// sets is_disabled when the object leaves it out.
+func linkPreviewArg(args map[string]any, disabled bool) (string, error) {
+	preview, ok := args["linkPreviewOptions"].(map[string]any)
+	if !ok {
+		return "", argErrorf("linkPreviewOptions must be an object")
+	}
+	for k, v := range preview {
+		want, known := linkPreviewFields[k]
+		if !known {
+			return "", argErrorf("linkPreviewOptions.%s is not a LinkPreviewOptions field", k)
+		}
+		if got := argKind(v); got != want {
+			return "", argErrorf("linkPreviewOptions.%s must be %s, got %s", k, article(want), got)
+		}
+	}
+
+	small, _ := preview["prefer_small_media"].(bool)
+	large, _ := preview["prefer_large_media"].(bool)
+	if small && large {
+		return "", argErrorf("linkPreviewOptions cannot set both prefer_small_media and prefer_large_media")
+	}
+	if url, _ := preview["url"].(string); (small || large) && url == "" {
+		return "", argErrorf("linkPreviewOptions.url is required with prefer_small_media or prefer_large_media")
+	}
+
+	if _, set := preview["is_disabled"]; !set && disabled {
+		merged := map[string]any{"is_disabled": true}
+		for k, v := range preview {
+			merged[k] = v
+		}
+		preview = merged
+	}
+
+	encoded, err := json.Marshal(preview)
+	if err != nil {
+		return "", argErrorf("linkPreviewOptions: %v", err)
+	}
+	return string(encoded), nil
+}
+
+// setDeliveryOptions sets the options SendMessage shares with the media
+// send methods: protectContent, which stops recipients forwarding or saving
+// the message, and messageEffectID, an animated effect shown on arrival in
+// private chats.
+func setDeliveryOptions(args map[string]any, form url.Values) error {
+	protect, hasProtect, err := boolArg(args, "protectContent")
+	if err != nil {
+		return err
+	}
+	if hasProtect {
+		form.Set("protect_content", strconv.FormatBool(protect))
+	}
+	if effect, _ := args["messageEffectID"].(string); effect != "" {
+		form.Set("message_effect_id", effect)
+	}
+	return nil
+}
+
+// entityFields are the MessageEntity types Telegram accepts, with the extra
+// field each one requires.
+var entityFields = map[string]string{
+	"mention": "", "hashtag": "", "cashtag": "", "bot_command": "", "url": "",
+	"email": "", "phone_number": "", "bold": "", "italic": "", "underline": "",
+	"strikethrough": "", "spoiler": "", "blockquote": "", "expandable_blockquote": "",
+	"code": "", "pre": "", "text_link": "url", "text_mention": "user",
+	"custom_emoji": "custom_emoji_id",
+}
+
+// entitiesArg validates args["entities"] against text and returns it JSON
+// encoded. Offsets and lengths are in UTF-16 code units, as Telegram counts
+// them.
+func entitiesArg(args map[string]any, text string) (string, bool, error) {
+	entities, err := mapsArg(args, "entities")
+	if err != nil || entities == nil {
+		return "", false, err
+	}
+
+	textLen := int64(utf16Len(text))
+	for i, e := range entities {
+		typ, _ := e["type"].(string)
+		extra, ok := entityFields[typ]
+		if !ok {
+			return "", false, argErrorf("entities[%d].type %q is not a Telegram entity type", i, typ)
+		}
+		if extra != "" && e[extra] == nil {
+			return "", false, argErrorf("entities[%d] of type %s requires %s", i, typ, extra)
+		}
+		offset, hasOffset, err := intArg(e, "offset")
+		if err != nil {
+			return "", false, argErrorf("entities[%d].offset must be an integer", i)
+		}
+		length, hasLength, err := intArg(e, "length")
+		if err != nil {
+			return "", false, argErrorf("entities[%d].length must be an integer", i)
+		}
+		if !hasOffset || !hasLength {
+			return "", false, argErrorf("entities[%d] requires offset and length", i)
+		}
+		// Compared without adding, which could overflow.
+		if offset < 0 || length <= 0 || offset > textLen || length > textLen-offset {
+			return "", false, argErrorf("entities[%d] (offset %d, length %d) is outside the text's %d UTF-16 characters", i, offset, length, textLen)
+		}
+	}
+
+	encoded, err := json.Marshal(entities)
+	if err != nil {
+		return "", false, err
+	}
+	return string(encoded), true, nil
+}
+
+var chatActions = map[string]bool{
+	"typing":            true,
+	"upload_photo":      true,
+	"record_video":      true,
+	"upload_video":      true,
+	"record_voice":      true,
+	"upload_voice":      true,
+	"upload_document":   true,
+	"choose_sticker":    true,
+	"find_location":     true,
+	"record_video_note": true,
+	"upload_video_note": true,
+}
+
+const (
+	// Telegram clears a chat action after about five seconds.
+	chatActionInterval  = 4 * time.Second
+	maxChatActionRepeat = 5 * time.Minute
+)
+
+// handleSendChatAction shows a status such as "typing…" in the chat. With
+// repeatUntilMs the action is re-sent in the background until the deadline
+// so it stays visible during long operations; the call itself returns as
+// soon as the first action has been sent.
+func (t *TelegramPlugin) handleSendChatAction(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	action, _ := args["action"].(string)
+	repeatMs, _, err := intArg(args, "repeatUntilMs")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || action == "" {
+		return invalidArgs("token, chatID and action are required")
+	}
+	if !chatActions[action] {
+		return invalidArgs("unsupported chat action: %s", action)
+	}
+	repeat := time.Duration(repeatMs) * time.Millisecond
+	if repeat < 0 || repeat > maxChatActionRepeat {
+		return invalidArgs("repeatUntilMs must be between 0 and %d", maxChatActionRepeat.Milliseconds())
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("action", action)
+
+	if err := callTelegram(ctx, token, "sendChatAction", form, nil); err != nil {
+		return fail(err)
+	}
+
+	if repeat > chatActionInterval {
+		until := time.Now().Add(repeat)
+		t.state.background.run(ctx, func(ctx context.Context) {
+			repeatChatAction(ctx, token, form, until)
+		})
+	}
+	return succeed(nil)
+}
+
+func repeatChatAction(ctx context.Context, token string, form url.Values, until time.Time) {
+	ticker := time.NewTicker(chatActionInterval)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		if now.After(until) {
+			return
+		}
+		if err := callTelegram(ctx, token, "sendChatAction", form, nil); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("sendChatAction repeat stopped", "error", err.Error())
+			return
+		}
+	}
+}
+
+// handleForwardMessage forwards a message from one chat to another, keeping
+// the "Forwarded from" attribution.
+func (t *TelegramPlugin) handleForwardMessage(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	fromChatID, _ := args["fromChatID"].(string)
+	chatID, _ := args["chatID"].(string)
+	messageID, err := idArg(args, "messageID")
+	if err != nil {
+		return fail(err)
+	}
+	silent, hasSilent, err := boolArg(args, "disableNotification")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || fromChatID == "" || chatID == "" || messageID == "" {
+		return invalidArgs("token, fromChatID, chatID and messageID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("from_chat_id", fromChatID)
+	form.Set("message_id", messageID)
+	if hasSilent {
+		form.Set("disable_notification", strconv.FormatBool(silent))
+	}
+
+	var sent message
+	if err := callTelegram(ctx, token, "forwardMessage", form, &sent); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"messageID": strconv.FormatInt(sent.MessageID, 10)})
+}
+
+// handleSendPoll posts a regular or quiz poll.
+func (t *TelegramPlugin) handleSendPoll(ctx context.Context, args map[string]any) sdk.Response {
+	args, err := renamedArg(args, "correctOptionID", "correctOptionId")
+	if err != nil {
+		return fail(err)
+	}
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	question, _ := args["question"].(string)
+	pollType, _ := args["type"].(string)
+	options, err := stringsArg(args, "options")
+	if err != nil {
+		return fail(err)
+	}
+	correct, hasCorrect, err := intArg(args, "correctOptionID")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || question == "" {
+		return invalidArgs("token, chatID and question are required")
+	}
+	if len(options) < 2 || len(options) > 10 {
+		return invalidArgs("options must contain between 2 and 10 items, got %d", len(options))
+	}
+	switch pollType {
+	case "", "regular":
+	case "quiz":
+		if !hasCorrect {
+			return invalidArgs("correctOptionID is required for quiz polls")
+		}
+		if correct < 0 || correct >= int64(len(options)) {
+			return invalidArgs("correctOptionID must be between 0 and %d", len(options)-1)
+		}
+	default:
+		return invalidArgs("type must be regular or quiz")
+	}
+
+	pollOptions := make([]map[string]string, len(options))
+	for i, o := range options {
+		pollOptions[i] = map[string]string{"text": o}
+	}
+	encoded, err := json.Marshal(pollOptions)
+	if err != nil {
+		return fail(err)
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("question", question)
+	form.Set("options", string(encoded))
+	if pollType != "" {
+		form.Set("type", pollType)
+	}
+	if pollType == "quiz" {
+		form.Set("correct_option_id", strconv.FormatInt(correct, 10))
+	}
+	for _, f := range []struct{ arg, field string }{
+		{"isAnonymous", "is_anonymous"},
+		{"allowsMultipleAnswers", "allows_multiple_answers"},
+	} {
+		v, ok, err := boolArg(args, f.arg)
+		if err != nil {
+			return fail(err)
+		}
+		if ok {
+			form.Set(f.field, strconv.FormatBool(v))
+		}
+	}
+
+	var sent struct {
+		MessageID int64 `json:"message_id"`
+		Poll      struct {
+			ID string `json:"id"`
+		} `json:"poll"`
+	}
+	if err := callTelegram(ctx, token, "sendPoll", form, &sent); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{
+		"messageID": strconv.FormatInt(sent.MessageID, 10),
+		"pollID":    sent.Poll.ID,
+	})
+}
+
+// locationForm validates the coordinates shared by SendLocation and
+// SendVenue and returns the base form for either call.
+func locationForm(args map[string]any) (url.Values, error) {
+	chatID, _ := args["chatID"].(string)
+	lat, hasLat, err := numberArg(args, "latitude")
+	if err != nil {
+		return nil, err
+	}
+	lon, hasLon, err := numberArg(args, "longitude")
+	if err != nil {
+		return nil, err
+	}
+
+	if chatID == "" || !hasLat || !hasLon {
+		return nil, argErrorf("chatID, latitude and longitude are required")
+	}
+	if lat < -90 || lat > 90 {
+		return nil, argErrorf("latitude must be between -90 and 90")
+	}
+	if lon < -180 || lon > 180 {
+		return nil, argErrorf("longitude must be between -180 and 180")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("latitude", strconv.FormatFloat(lat, 'f', -1, 64))
+	form.Set("longitude", strconv.FormatFloat(lon, 'f', -1, 64))
+	return form, nil
+}
+
+// handleSendLocation shares a point on the map. With livePeriod the location
+// is live and can be updated through editMessageLiveLocation using the
+// returned message ID.
+func (t *TelegramPlugin) handleSendLocation(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	form, err := locationForm(args)
+	if err != nil {
+		return fail(err)
+	}
+
+	accuracy, hasAccuracy, err := numberArg(args, "horizontalAccuracy")
+	if err != nil {
+		return fail(err)
+	}
+	if hasAccuracy {
+		if accuracy < 0 || accuracy > 1500 {
+			return invalidArgs("horizontalAccuracy must be between 0 and 1500 meters")
+		}
+		form.Set("horizontal_accuracy", strconv.FormatFloat(accuracy, 'f', -1, 64))
+	}
+
+	livePeriod, hasLive, err := intArg(args, "livePeriod")
+	if err != nil {
+		return fail(err)
+	}
+	// 0x7FFFFFFF means the location is shared until stopped explicitly.
+	if hasLive {
+		if (livePeriod < 60 || livePeriod > 86400) && livePeriod != 0x7FFFFFFF {
+			return invalidArgs("livePeriod must be between 60 and 86400 seconds, or 2147483647 for indefinitely")
+		}
+		form.Set("live_period", strconv.FormatInt(livePeriod, 10))
+	}
+
+	var sent message
+	if err := callTelegram(ctx, token, "sendLocation", form, &sent); err != nil {
+		return fail(err)
+	}
+
+	data := map[string]any{"messageID": strconv.FormatInt(sent.MessageID, 10)}
+	if hasLive {
+		data["livePeriod"] = livePeriod
+	}
+	return succeed(data)
+}
+
+// handleSendVenue shares a named place with its address.
+func (t *TelegramPlugin) handleSendVenue(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	title, _ := args["title"].(string)
+	address, _ := args["address"].(string)
+	if token == "" || title == "" || address == "" {
+		return invalidArgs("token, title and address are required")
+	}
+	form, err := locationForm(args)
+	if err != nil {
+		return fail(err)
+	}
+	form.Set("title", title)
+	form.Set("address", address)
+
+	var sent message
+	if err := callTelegram(ctx, token, "sendVenue", form, &sent); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"messageID": strconv.FormatInt(sent.MessageID, 10)})
+}
+
+// handleSendContact sends a contact card. vcard, when given, is passed to
+// Telegram as is.
+func (t *TelegramPlugin) handleSendContact(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	phoneNumber, _ := args["phoneNumber"].(string)
+	firstName, _ := args["firstName"].(string)
+	if token == "" || chatID == "" || strings.TrimSpace(phoneNumber) == "" || strings.TrimSpace(firstName) == "" {
+		return invalidArgs("token, chatID, phoneNumber and firstName are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("phone_number", phoneNumber)
+	form.Set("first_name", firstName)
+	if lastName, _ := args["lastName"].(string); lastName != "" {
+		form.Set("last_name", lastName)
+	}
+	if vcard, _ := args["vcard"].(string); vcard != "" {
+		form.Set("vcard", vcard)
+	}
+
+	var sent message
+	if err := callTelegram(ctx, token, "sendContact", form, &sent); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"messageID": strconv.FormatInt(sent.MessageID, 10)})
+}
+
+var diceEmoji = map[string]bool{"🎲": true, "🎯": true, "🏀": true, "⚽": true, "🎳": true, "🎰": true}
+
+// handleSendDice sends an animated emoji with a random value chosen by
+// Telegram, which is returned alongside the message ID.
+func (t *TelegramPlugin) handleSendDice(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	emoji, _ := args["emoji"].(string)
+
+	if token == "" || chatID == "" {
+		return invalidArgs("token and chatID are required")
+	}
+	if emoji == "" {
+		emoji = "🎲"
+	}
+	if !diceEmoji[emoji] {
+		return invalidArgs("emoji must be one of 🎲 🎯 🏀 ⚽ 🎳 🎰")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("emoji", emoji)
+
+	var sent struct {
+		MessageID int64 `json:"message_id"`
+		Dice      struct {
+			Value int64 `json:"value"`
+		} `json:"dice"`
+	}
+	if err := callTelegram(ctx, token, "sendDice", form, &sent); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{
+		"messageID": strconv.FormatInt(sent.MessageID, 10),
+		"value":     sent.Dice.Value,
+	})
+}
+
+// handleCopyMessage re-posts a message to another chat without the
+// "Forwarded from" header, optionally replacing its caption.
+func (t *TelegramPlugin) handleCopyMessage(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	fromChatID, _ := args["fromChatID"].(string)
+	chatID, _ := args["chatID"].(string)
+	messageID, err := idArg(args, "messageID")
+	if err != nil {
+		return fail(err)
+	}
+	replyMarkup, hasMarkup, err := jsonArg(args, "replyMarkup")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || fromChatID == "" || chatID == "" || messageID == "" {
+		return invalidArgs("token, fromChatID, chatID and messageID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("from_chat_id", fromChatID)
+	form.Set("message_id", messageID)
+	// An explicitly empty caption removes the original one.
+	if caption, ok := args["caption"].(string); ok {
+		form.Set("caption", caption)
+	}
+	if parseMode, _ := args["parseMode"].(string); parseMode != "" {
+		form.Set("parse_mode", parseMode)
+	}
+	if hasMarkup {
+		form.Set("reply_markup", replyMarkup)
+	}
+
+	var copied message
+	if err := callTelegram(ctx, token, "copyMessage", form, &copied); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"messageID": strconv.FormatInt(copied.MessageID, 10)})
+}
+
+// reactionEmoji are the emoji Telegram accepts as ReactionTypeEmoji, stored
+// without the U+FE0F variation selector that keyboards often add.
+var reactionEmoji = map[string]bool{}
+
+func init() {
+	for _, e := range []string{
+		"👍", "👎", "❤", "🔥", "🥰", "👏", "😁", "🤔", "🤯", "😱", "🤬", "😢", "🎉", "🤩", "🤮",
+		"💩", "🙏", "👌", "🕊", "🤡", "🥱", "🥴", "😍", "🐳", "❤‍🔥", "🌚", "🌭", "💯", "🤣", "⚡",
+		"🍌", "🏆", "💔", "🤨", "😐", "🍓", "🍾", "💋", "🖕", "😈", "😴", "😭", "🤓", "👻", "👨‍💻",
+		"👀", "🎃", "🙈", "😇", "😨", "🤝", "✍", "🤗", "🫡", "🎅", "🎄", "☃", "💅", "🤪", "🗿",
+		"🆒", "💘", "🙉", "🦄", "😘", "💊", "🙊", "😎", "👾", "🤷‍♂", "🤷", "🤷‍♀", "😡",
+	} {
+		reactionEmoji[e] = true
+	}
+}
+
+// reactionTypes converts the reaction argument into ReactionType objects.
+// Entries are emoji strings, or objects carrying a custom_emoji_id.
+func reactionTypes(v any) ([]map[string]string, error) {
+	var items []any
+	switch v := v.(type) {
+	case []any:
+		items = v
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	case []map[string]any:
+		for _, m := range v {
+			items = append(items, m)
+		}
+	default:
+		return nil, argErrorf("reaction must be an array")
+	}
+
+	out := make([]map[string]string, 0, len(items))
+	for i, item := range items {
+		switch item := item.(type) {
+		case string:
+			emoji := strings.ReplaceAll(item, "\ufe0f", "")
+			if !reactionEmoji[emoji] {
+				return nil, argErrorf("reaction[%d]: %q is not a supported reaction emoji", i, item)
+			}
+			out = append(out, map[string]string{"type": "emoji", "emoji": emoji})
+		case map[string]any:
+			id, _ := item["custom_emoji_id"].(string)
+			if id == "" {
+				return nil, argErrorf("reaction[%d]: custom_emoji_id is required", i)
+			}
+			out = append(out, map[string]string{"type": "custom_emoji", "custom_emoji_id": id})
+		default:
+			return nil, argErrorf("reaction[%d] must be an emoji or an object with custom_emoji_id", i)
+		}
+	}
+	return out, nil
+}
+
+// handleSetMessageReaction sets the bot's reactions on a message. An empty
+// reaction array removes them.
+func (t *TelegramPlugin) handleSetMessageReaction(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	messageID, err := idArg(args, "messageID")
+	if err != nil {
+		return fail(err)
+	}
+	isBig, hasBig, err := boolArg(args, "isBig")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || messageID == "" || args["reaction"] == nil {
+		return invalidArgs("token, chatID, messageID and reaction are required")
+	}
+	reaction, err := reactionTypes(args["reaction"])
+	if err != nil {
+		return fail(err)
+	}
+	encoded, err := json.Marshal(reaction)
+	if err != nil {
+		return fail(err)
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("message_id", messageID)
+	form.Set("reaction", string(encoded))
+	if hasBig {
+		form.Set("is_big", strconv.FormatBool(isBig))
+	}
+
+	if err := callTelegram(ctx, token, "setMessageReaction", form, nil); err != nil {
+		return fail(err)
+	}
+	return succeed(nil)
+}
+
+// notModified reports whether err is Telegram refusing an edit that would
+// leave the message exactly as it is.
+func notModified(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(apiErr.Description, "message is not modified")
+}
+
+// handleEditMessageReplyMarkup replaces the inline keyboard of a message,
+// or removes it when replyMarkup is omitted. Repeating an edit is not an
+// error: it succeeds with modified set to false.
+func (t *TelegramPlugin) handleEditMessageReplyMarkup(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	messageID, err := idArg(args, "messageID")
+	if err != nil {
+		return fail(err)
+	}
+	replyMarkup, hasMarkup, err := jsonArg(args, "replyMarkup")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || messageID == "" {
+		return invalidArgs("token, chatID and messageID are required")
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("message_id", messageID)
+	if hasMarkup {
+		form.Set("reply_markup", replyMarkup)
+	}
+
+	var edited message
+	err = callTelegram(ctx, token, "editMessageReplyMarkup", form, &edited)
+	switch {
+	case notModified(err):
+		return succeed(map[string]any{"messageID": messageID, "modified": false})
+	case err != nil:
+		return fail(err)
+	}
+	return succeed(map[string]any{"messageID": strconv.FormatInt(edited.MessageID, 10), "modified": true})
+}
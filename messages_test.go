@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"fits", "hello world", 20, []string{"hello world"}},
+		{"at paragraph break", "aaaa aaaa\n\nbbbb", 12, []string{"aaaa aaaa", "bbbb"}},
+		{"at line break", "aaaa aaaa\nbbbb", 12, []string{"aaaa aaaa", "bbbb"}},
+		{"at space", "aaaa aaaa bbbb", 12, []string{"aaaa aaaa", "bbbb"}},
+		{"mid-word", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		// Surrogate pairs count as two units and are never cut.
+		{"surrogate pairs", "😀😀😀", 5, []string{"😀😀", "😀"}},
+		{"drops whitespace-only parts", "aaaa" + strings.Repeat(" ", 10) + "bbbb", 5, []string{"aaaa", "bbbb"}},
+		{"all whitespace", strings.Repeat(" ", 10), 4, nil},
+		{"all newlines", strings.Repeat("\n", 10), 4, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitMessage(tc.text, tc.limit)
+			if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+				t.Errorf("splitMessage(%q, %d) = %q, want %q", tc.text, tc.limit, got, tc.want)
+			}
+			for _, part := range got {
+				if n := utf16Len(part); n > tc.limit {
+					t.Errorf("part %q is %d units, over %d", part, n, tc.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestSendMessageRejectsWhitespaceOnlySplit(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	res := callRaw(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": strings.Repeat(" ", maxMessageLength+1), "autoSplit": true})
+	if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+		t.Fatalf("got Success=%v errorCode=%v, want INVALID_ARGS", res.Success, data["errorCode"])
+	}
+	if got := stub.count("sendMessage"); got != 0 {
+		t.Errorf("sendMessage called %d times", got)
+	}
+}
+
+// fanOutResults returns the per-chat results of a fan-out SendMessage.
+func fanOutResults(t *testing.T, data map[string]any) []map[string]any {
+	t.Helper()
+	raw, _ := data["results"].([]any)
+	out := make([]map[string]any, len(raw))
+	for i, r := range raw {
+		out[i] = r.(map[string]any)
+	}
+	return out
+}
+
+func TestFanOut(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	stub.failChats.Store("2", 403)
+
+	data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": []any{"1", "2", "3"}, "text": "hi"})
+	if data["sent"] != 2 || data["failed"] != 1 {
+		t.Errorf("sent = %v, failed = %v; want 2, 1", data["sent"], data["failed"])
+	}
+	results := fanOutResults(t, data)
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	for i, chatID := range []string{"1", "2", "3"} {
+		r := results[i]
+		if r["chatID"] != chatID {
+			t.Errorf("results[%d].chatID = %v, want %s", i, r["chatID"], chatID)
+		}
+		if chatID == "2" {
+			if r["success"] != false || r["errorCode"] != codeUpstreamForbidden || r["error"] == nil {
+				t.Errorf("failed chat result = %v", r)
+			}
+			continue
+		}
+		if r["success"] != true || r["messageID"] == nil {
+			t.Errorf("results[%d] = %v", i, r)
+		}
+	}
+	if len(stub.sentTexts("1")) != 1 || len(stub.sentTexts("3")) != 1 {
+		t.Errorf("texts sent: 1 = %q, 3 = %q", stub.sentTexts("1"), stub.sentTexts("3"))
+	}
+}
+
+func TestFanOutAllFailed(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	stub.failChats.Store("1", 403)
+	stub.failChats.Store("2", 400)
+
+	res := callRaw(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": []any{"1", "2"}, "text": "hi"})
+	data, _ := res.Data.(map[string]any)
+	if res.Success || data["failed"] != 2 || data["errorCode"] != codeUpstreamForbidden {
+		t.Errorf("Success=%v failed=%v errorCode=%v; want false, 2, the first chat's code", res.Success, data["failed"], data["errorCode"])
+	}
+	if len(fanOutResults(t, data)) != 2 {
+		t.Errorf("results = %v", data["results"])
+	}
+}
+
+// Idempotency keys apply per chat: a retried fan-out only sends to the chats
+// that have not received the message.
+func TestFanOutIdempotencyKey(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	args := func(chats ...any) map[string]any {
+		return map[string]any{"token": "1:T", "chatID": chats, "text": "hi", "idempotencyKey": "k"}
+	}
+
+	stub.failChats.Store("2", 500)
+	call(t, p, "SendMessage", args("1", "2"))
+	stub.failChats.Delete("2")
+
+	results := fanOutResults(t, call(t, p, "SendMessage", args("1", "2", "3")))
+	for i, want := range []bool{true, false, false} {
+		if results[i]["success"] != true || results[i]["deduplicated"] != want {
+			t.Errorf("results[%d] = %v, want deduplicated %v", i, results[i], want)
+		}
+	}
+	for _, chatID := range []string{"1", "2", "3"} {
+		if got := len(stub.sentTexts(chatID)); got != 1 {
+			t.Errorf("chat %s received %d messages, want 1", chatID, got)
+		}
+	}
+}
+
+func TestFanOutAutoSplit(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	text := strings.Repeat("a", maxMessageLength) + " tail"
+
+	data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": []any{"1", "2"}, "text": text, "autoSplit": true})
+	for i, r := range fanOutResults(t, data) {
+		if ids, _ := r["messageIDs"].([]string); len(ids) != 2 {
+			t.Errorf("results[%d].messageIDs = %v, want 2 IDs", i, r["messageIDs"])
+		}
+	}
+	for _, chatID := range []string{"1", "2"} {
+		if got := stub.sentTexts(chatID); len(got) != 2 || strings.TrimSpace(got[1]) != "tail" {
+			t.Errorf("chat %s received %d parts", chatID, len(got))
+		}
+	}
+}
+
+func TestEntitiesArg(t *testing.T) {
+	const text = "hi 😀 there" // 😀 is two UTF-16 units, so the text is 11
+	entity := func(fields ...any) map[string]any {
+		e := map[string]any{}
+		for i := 0; i < len(fields); i += 2 {
+			e[fields[i].(string)] = fields[i+1]
+		}
+		return e
+	}
+	for _, tc := range []struct {
+		name     string
+		entities any
+		ok       bool
+	}{
+		{"bold", []any{entity("type", "bold", "offset", 0, "length", 2)}, true},
+		{"up to the end", []any{entity("type", "italic", "offset", 3, "length", 8)}, true},
+		{"as []map", []map[string]any{entity("type", "code", "offset", 0, "length", 11)}, true},
+		{"float offsets", []any{entity("type", "bold", "offset", 0.0, "length", 2.0)}, true},
+		{"text_link", []any{entity("type", "text_link", "offset", 0, "length", 2, "url", "https://x.y")}, true},
+		{"not an array", "bold", false},
+		{"not objects", []any{"bold"}, false},
+		{"unknown type", []any{entity("type", "blink", "offset", 0, "length", 2)}, false},
+		{"missing type", []any{entity("offset", 0, "length", 2)}, false},
+		{"text_link without url", []any{entity("type", "text_link", "offset", 0, "length", 2)}, false},
+		{"missing offset", []any{entity("type", "bold", "length", 2)}, false},
+		{"missing length", []any{entity("type", "bold", "offset", 0)}, false},
+		{"fractional offset", []any{entity("type", "bold", "offset", 0.5, "length", 2)}, false},
+		{"string length", []any{entity("type", "bold", "offset", 0, "length", "two")}, false},
+		{"negative offset", []any{entity("type", "bold", "offset", -1, "length", 2)}, false},
+		{"zero length", []any{entity("type", "bold", "offset", 0, "length", 0)}, false},
+		{"past the end in UTF-16", []any{entity("type", "bold", "offset", 3, "length", 9)}, false},
+		{"overflowing", []any{entity("type", "bold", "offset", 2, "length", int64(math.MaxInt64))}, false},
+		{"second entity bad", []any{entity("type", "bold", "offset", 0, "length", 2), entity("type", "bold", "offset", 20, "length", 1)}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, has, err := entitiesArg(map[string]any{"entities": tc.entities}, text)
+			if tc.ok {
+				if err != nil || !has || !json.Valid([]byte(encoded)) {
+					t.Errorf("entitiesArg = %q, %v, %v", encoded, has, err)
+				}
+				return
+			}
+			if errorCode(err) != codeInvalidArgs {
+				t.Errorf("err = %v, want INVALID_ARGS", err)
+			}
+		})
+	}
+	if _, has, err := entitiesArg(map[string]any{}, text); has || err != nil {
+		t.Errorf("no entities = %v, %v", has, err)
+	}
+}
+
+func TestSendMessageEntities(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	bold := []any{map[string]any{"type": "bold", "offset": 0, "length": 2}}
+
+	call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": "hi", "entities": bold})
+
+	for name, args := range map[string]map[string]any{
+		"too long for one message": {"text": strings.Repeat("a", maxMessageLength+1), "autoSplit": true},
+		"with parseMode":           {"text": "hi", "parseMode": "HTML"},
+		"with formatMarkdown":      {"text": "hi", "formatMarkdown": true},
+	} {
+		args["token"], args["chatID"], args["entities"] = "1:T", "1", bold
+		res := callRaw(t, p, "SendMessage", args)
+		if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+			t.Errorf("%s: Success=%v errorCode=%v, want INVALID_ARGS", name, res.Success, data["errorCode"])
+		}
+	}
+	if got := stub.count("sendMessage"); got != 1 {
+		t.Errorf("sendMessage called %d times, want 1", got)
+	}
+}
+
+func TestMessageLink(t *testing.T) {
+	msg := func(id int64, username string) message {
+		var m message
+		m.MessageID, m.Chat.ID, m.Chat.Username = 42, id, username
+		return m
+	}
+	for _, tc := range []struct {
+		name string
+		m    message
+		want string
+	}{
+		{"public channel", msg(-1001234567890, "news"), "https://t.me/news/42"},
+		{"public group by username", msg(-100, "chatters"), "https://t.me/chatters/42"},
+		{"private supergroup", msg(-1001234567890, ""), "https://t.me/c/1234567890/42"},
+		{"basic group", msg(-123456, ""), ""},
+		{"private chat", msg(123456, ""), ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := messageLink(tc.m); got != tc.want {
+				t.Errorf("messageLink = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfirmSent(t *testing.T) {
+	msg := func(id int64, date time.Time) message {
+		var m message
+		m.MessageID = id
+		if !date.IsZero() {
+			m.Date = date.Unix()
+		}
+		return m
+	}
+	now := time.Now()
+	for _, tc := range []struct {
+		name string
+		m    message
+		ok   bool
+	}{
+		{"sent now", msg(1, now), true},
+		{"slightly skewed", msg(1, now.Add(-time.Minute)), true},
+		{"no message_id", msg(0, now), false},
+		{"no date", msg(1, time.Time{}), false},
+		{"too old", msg(1, now.Add(-time.Hour)), false},
+		{"in the future", msg(1, now.Add(time.Hour)), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := confirmSent(tc.m)
+			if tc.ok != (err == nil) {
+				t.Errorf("confirmSent = %v", err)
+			}
+			if err != nil && errorCode(err) != codeUpstreamError {
+				t.Errorf("error code %s, want %s", errorCode(err), codeUpstreamError)
+			}
+		})
+	}
+}
+
+func TestSendMessageConfirmDelivery(t *testing.T) {
+	p, _ := newStubbedPlugin(t)
+	for _, tc := range []struct {
+		chatID, link string
+	}{
+		{"@news", "https://t.me/news/"},
+		{"-1001234567890", "https://t.me/c/1234567890/"},
+		{"123456", ""},
+	} {
+		before := time.Now().Add(-time.Second)
+		data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": tc.chatID, "text": "hi", "confirmDelivery": true})
+		sentAt, err := time.Parse(time.RFC3339, fmt.Sprint(data["sentAt"]))
+		if err != nil || sentAt.Before(before.Truncate(time.Second)) || sentAt.After(time.Now()) {
+			t.Errorf("%s: sentAt = %v", tc.chatID, data["sentAt"])
+		}
+		if tc.link == "" {
+			if data["link"] != nil {
+				t.Errorf("%s: link = %v, want none", tc.chatID, data["link"])
+			}
+		} else if link := fmt.Sprint(data["link"]); link != tc.link+fmt.Sprint(data["messageID"]) {
+			t.Errorf("%s: link = %s", tc.chatID, link)
+		}
+	}
+
+	// Without confirmDelivery neither is reported.
+	data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "@news", "text": "hi"})
+	if data["sentAt"] != nil || data["link"] != nil {
+		t.Errorf("sentAt = %v, link = %v without confirmDelivery", data["sentAt"], data["link"])
+	}
+}
+
+func TestLinkPreviewOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args map[string]any
+		want url.Values // nil when rejected
+	}{
+		{"disableWebPagePreview alone", map[string]any{"disableWebPagePreview": true},
+			url.Values{"disable_web_page_preview": {"true"}}},
+		{"linkPreviewOptions alone", map[string]any{"linkPreviewOptions": map[string]any{"show_above_text": true}},
+			url.Values{"link_preview_options": {`{"show_above_text":true}`}}},
+		{"url with preference", map[string]any{"linkPreviewOptions": map[string]any{"url": "https://x.y", "prefer_small_media": true}},
+			url.Values{"link_preview_options": {`{"prefer_small_media":true,"url":"https://x.y"}`}}},
+		// With both, disableWebPagePreview fills in is_disabled...
+		{"both, is_disabled unset", map[string]any{"disableWebPagePreview": true, "linkPreviewOptions": map[string]any{"show_above_text": true}},
+			url.Values{"link_preview_options": {`{"is_disabled":true,"show_above_text":true}`}}},
+		// ...and linkPreviewOptions' own is_disabled wins.
+		{"both, is_disabled false", map[string]any{"disableWebPagePreview": true, "linkPreviewOptions": map[string]any{"is_disabled": false}},
+			url.Values{"link_preview_options": {`{"is_disabled":false}`}}},
+		{"both, disableWebPagePreview false", map[string]any{"disableWebPagePreview": false, "linkPreviewOptions": map[string]any{"url": "https://x.y"}},
+			url.Values{"link_preview_options": {`{"url":"https://x.y"}`}}},
+		{"not an object", map[string]any{"linkPreviewOptions": "{}"}, nil},
+		{"unknown field", map[string]any{"linkPreviewOptions": map[string]any{"isDisabled": true}}, nil},
+		{"wrong field type", map[string]any{"linkPreviewOptions": map[string]any{"is_disabled": "yes"}}, nil},
+		{"small and large", map[string]any{"linkPreviewOptions": map[string]any{"url": "https://x.y", "prefer_small_media": true, "prefer_large_media": true}}, nil},
+		{"preference without url", map[string]any{"linkPreviewOptions": map[string]any{"prefer_large_media": true}}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := sendMessageOptions(tc.args)
+			if tc.want == nil {
+				if errorCode(err) != codeInvalidArgs {
+					t.Errorf("err = %v, want INVALID_ARGS", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Encode() != tc.want.Encode() {
+				t.Errorf("options = %s, want %s", opts.Encode(), tc.want.Encode())
+			}
+		})
+	}
+}
+
+func TestSendPollCorrectOptionID(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	base := map[string]any{"token": "1:T", "chatID": "1", "question": "Lunch?", "options": []any{"Pizza", "Sushi", "Salad"}, "type": "quiz"}
+	with := func(extra map[string]any) map[string]any {
+		args := map[string]any{}
+		for k, v := range base {
+			args[k] = v
+		}
+		for k, v := range extra {
+			args[k] = v
+		}
+		return args
+	}
+
+	for _, name := range []string{"correctOptionID", "correctOptionId"} {
+		t.Run(name, func(t *testing.T) {
+			data := call(t, p, "SendPoll", with(map[string]any{name: 2}))
+			if data["pollID"] != "p1" {
+				t.Errorf("pollID = %v, want p1", data["pollID"])
+			}
+			if got := stub.lastForm("sendPoll").Get("correct_option_id"); got != "2" {
+				t.Errorf("correct_option_id = %q, want 2", got)
+			}
+		})
+	}
+
+	for name, extra := range map[string]map[string]any{
+		"missing":      {},
+		"out of range": {"correctOptionID": 3},
+		"both":         {"correctOptionID": 1, "correctOptionId": 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := callRaw(t, p, "SendPoll", with(extra))
+			if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+				t.Errorf("SendPoll = %v, %v; want %s", res.Success, res.Data, codeInvalidArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// pluginName labels every metric so dashboards can tell Orka plugins apart.
+const pluginName = "telegram"
+
+// latencyBuckets are the upper bounds, in seconds, of the call duration
+// histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// callMetrics aggregates CallMethod invocations for the --metrics-port
+// endpoint. It is always updated; the cost is a map lookup per call.
+var callMetrics = newMetrics()
+
+type metrics struct {
+	mu      sync.Mutex
+	methods map[string]*methodStats
+}
+
+type methodStats struct {
+	calls   uint64
+	errors  map[string]uint64 // by error code
+	buckets []uint64          // per latencyBuckets entry, not cumulative
+	sum     float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{methods: make(map[string]*methodStats)}
+}
+
+func (m *metrics) observe(method string, res *sdk.Response, d time.Duration) {
+	code := ""
+	if !res.Success {
+		code = codeInternal
+		if data, ok := res.Data.(map[string]any); ok {
+			if c, ok := data["errorCode"].(string); ok {
+				code = c
+			}
+		}
+	}
+	// Unknown method names come from callers; don't let them create series.
+	if code == codeUnknownMethod {
+		method = "unknown"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.methods[method]
+	if !ok {
+		stats = &methodStats{errors: make(map[string]uint64), buckets: make([]uint64, len(latencyBuckets))}
+		m.methods[method] = stats
+	}
+	stats.calls++
+	if code != "" {
+		stats.errors[code]++
+	}
+	secs := d.Seconds()
+	stats.sum += secs
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			stats.buckets[i]++
+			break
+		}
+	}
+}
+
+// writeTo renders the metrics in the Prometheus text exposition format.
+func (m *metrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	methods := make([]string, 0, len(m.methods))
+	for name := range m.methods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+
+	fmt.Fprintln(w, "# HELP orka_plugin_calls_total Plugin method calls.")
+	fmt.Fprintln(w, "# TYPE orka_plugin_calls_total counter")
+	for _, name := range methods {
+		fmt.Fprintf(w, "orka_plugin_calls_total{plugin=%q,method=%q} %d\n", pluginName, name, m.methods[name].calls)
+	}
+
+	fmt.Fprintln(w, "# HELP orka_plugin_call_errors_total Failed plugin method calls by error code.")
+	fmt.Fprintln(w, "# TYPE orka_plugin_call_errors_total counter")
+	for _, name := range methods {
+		stats := m.methods[name]
+		codes := make([]string, 0, len(stats.errors))
+		for code := range stats.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "orka_plugin_call_errors_total{plugin=%q,method=%q,code=%q} %d\n", pluginName, name, code, stats.errors[code])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP orka_plugin_call_duration_seconds Plugin method call latency.")
+	fmt.Fprintln(w, "# TYPE orka_plugin_call_duration_seconds histogram")
+	for _, name := range methods {
+		stats := m.methods[name]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += stats.buckets[i]
+			fmt.Fprintf(w, "orka_plugin_call_duration_seconds_bucket{plugin=%q,method=%q,le=\"%g\"} %d\n", pluginName, name, le, cumulative)
+		}
+		fmt.Fprintf(w, "orka_plugin_call_duration_seconds_bucket{plugin=%q,method=%q,le=\"+Inf\"} %d\n", pluginName, name, stats.calls)
+		fmt.Fprintf(w, "orka_plugin_call_duration_seconds_sum{plugin=%q,method=%q} %g\n", pluginName, name, stats.sum)
+		fmt.Fprintf(w, "orka_plugin_call_duration_seconds_count{plugin=%q,method=%q} %d\n", pluginName, name, stats.calls)
+	}
+}
+
+// serveMetrics exposes /metrics on localhost:port in the background.
+func serveMetrics(port int) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		callMetrics.writeTo(w)
+	})
+
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			logger.Error("metrics server stopped", "error", err.Error())
+		}
+	}()
+	return nil
+}
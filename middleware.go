@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// handler serves one call. The method dispatch is the last handler of the
+// middleware chain.
+type handler func(ctx context.Context, req sdk.Request) sdk.Response
+
+// middleware wraps every call: it can act before and after calling next, or
+// answer the call itself without calling next.
+type middleware func(ctx context.Context, req sdk.Request, next handler) sdk.Response
+
+// middlewares are the built-in middlewares --middleware chooses from.
+var middlewares = map[string]middleware{
+	"tracing": traceMiddleware,
+	"logging": logMiddleware,
+	"metrics": metricsMiddleware,
+	"recover": recoverMiddleware,
+}
+
+// defaultMiddleware traces, logs and counts every call, with panics turned
+// into INTERNAL errors before they are logged and counted.
+const defaultMiddleware = "tracing,logging,metrics,recover"
+
+// middlewareChain, set by --middleware, runs around every call, outermost
+// first.
+var middlewareChain, _ = parseMiddleware(defaultMiddleware)
+
+// parseMiddleware reads a comma-separated list of middleware names.
+func parseMiddleware(list string) ([]middleware, error) {
+	var chain []middleware
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		mw, ok := middlewares[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q; choose from tracing, logging, metrics and recover", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("middleware %q is listed twice", name)
+		}
+		seen[name] = true
+		chain = append(chain, mw)
+	}
+	return chain, nil
+}
+
+// chain wraps h in mws, the first of them outermost.
+func chain(mws []middleware, h handler) handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		mw, next := mws[i], h
+		h = func(ctx context.Context, req sdk.Request) sdk.Response {
+			return mw(ctx, req, next)
+		}
+	}
+	return h
+}
+
+func traceMiddleware(ctx context.Context, req sdk.Request, next handler) sdk.Response {
+	ctx, span := startCallSpan(ctx, req)
+	res := next(ctx, req)
+	endCallSpan(span, &res)
+	return res
+}
+
+func logMiddleware(ctx context.Context, req sdk.Request, next handler) sdk.Response {
+	start := time.Now()
+	res := next(ctx, req)
+	logCall(ctx, req, &res, time.Since(start))
+	return res
+}
+
+func metricsMiddleware(ctx context.Context, req sdk.Request, next handler) sdk.Response {
+	start := time.Now()
+	res := next(ctx, req)
+	callMetrics.observe(req.Method, &res, time.Since(start))
+	return res
+}
+
+// recoverMiddleware answers a call whose handler panicked with an INTERNAL
+// error, so middleware outside it log and count it like any other failure.
+func recoverMiddleware(ctx context.Context, req sdk.Request, next handler) (res sdk.Response) {
+	defer func() {
+		if p := recover(); p != nil {
+			res = panicResponse(ctx, req, p)
+		}
+	}()
+	return next(ctx, req)
+}
+
+// panicResponse logs a panic in a call and builds its INTERNAL error. The
+// stack is only logged at debug level and never returned to the caller.
+func panicResponse(ctx context.Context, req sdk.Request, p any) sdk.Response {
+	attrs := append([]any{"method", req.Method}, callAttrs(ctx)...)
+	logger.Error("call panicked", append(attrs, "panic", fmt.Sprint(p))...)
+	logger.Debug("call panic stack", append(attrs, "stack", string(debug.Stack()))...)
+	return sdk.Response{Success: false, Error: "internal error", Data: map[string]any{"errorCode": codeInternal}}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+func panicking(ctx context.Context, req sdk.Request) sdk.Response {
+	var m map[string]int
+	m["boom"]++
+	return sdk.Response{Success: true}
+}
+
+func panicMiddleware(ctx context.Context, req sdk.Request, next handler) sdk.Response {
+	return panicking(ctx, req)
+}
+
+func assertInternalError(t *testing.T, res sdk.Response) {
+	t.Helper()
+	if res.Success {
+		t.Fatal("Success = true, want false")
+	}
+	if res.Error != "internal error" {
+		t.Errorf("Error = %q, want %q", res.Error, "internal error")
+	}
+	data, _ := res.Data.(map[string]any)
+	if data["errorCode"] != codeInternal {
+		t.Errorf("errorCode = %v, want %s", data["errorCode"], codeInternal)
+	}
+}
+
+func TestChainRecoversPanic(t *testing.T) {
+	res := chain([]middleware{logMiddleware, recoverMiddleware}, panicking)(context.Background(), sdk.Request{Method: "Panic"})
+	assertInternalError(t, res)
+}
+
+func TestCallMethodSurvivesPanic(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		chain []middleware
+	}{
+		// Caught by recoverMiddleware.
+		{"recover middleware", []middleware{logMiddleware, recoverMiddleware, panicMiddleware}},
+		// Caught by CallMethod itself.
+		{"no recover middleware", []middleware{logMiddleware, panicMiddleware}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL))
+			saved := middlewareChain
+			middlewareChain = tc.chain
+			t.Cleanup(func() { middlewareChain = saved })
+
+			var res sdk.Response
+			if err := p.CallMethod(sdk.Request{Method: "Version", Args: map[string]any{}}, &res); err != nil {
+				t.Fatalf("CallMethod: %v", err)
+			}
+			assertInternalError(t, res)
+			if data, _ := res.Data.(map[string]any); data["requestID"] == "" || data["requestID"] == nil {
+				t.Error("panicked call has no requestID")
+			}
+
+			middlewareChain = saved
+			res = sdk.Response{}
+			if err := p.CallMethod(sdk.Request{Method: "Version", Args: map[string]any{}}, &res); err != nil {
+				t.Fatalf("CallMethod: %v", err)
+			}
+			if !res.Success {
+				t.Errorf("call after the panic failed: %s", res.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// currencyCode is an ISO 4217 code. Telegram rejects the ones it does not
+// support, so only the shape is checked here.
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// starsCurrency is Telegram Stars, used for digital goods. Invoices in it
+// need no payment provider and take exactly one price.
+const starsCurrency = "XTR"
+
+// handleSendInvoice sends an invoice for the user to pay in the chat. Price
+// amounts are integers in the currency's smallest unit, e.g. cents.
+func (t *TelegramPlugin) handleSendInvoice(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	chatID, _ := args["chatID"].(string)
+	title, _ := args["title"].(string)
+	description, _ := args["description"].(string)
+	payload, _ := args["payload"].(string)
+	providerToken, _ := args["providerToken"].(string)
+	currency, _ := args["currency"].(string)
+	prices, err := mapsArg(args, "prices")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || chatID == "" || title == "" || description == "" || payload == "" || currency == "" || len(prices) == 0 {
+		return invalidArgs("token, chatID, title, description, payload, currency and prices are required")
+	}
+	currency = strings.ToUpper(currency)
+	if !currencyCode.MatchString(currency) {
+		return invalidArgs("currency must be a three-letter ISO 4217 code")
+	}
+	if currency == starsCurrency {
+		if len(prices) != 1 {
+			return invalidArgs("invoices in %s take exactly one price", starsCurrency)
+		}
+	} else if providerToken == "" {
+		return invalidArgs("providerToken is required unless currency is %s", starsCurrency)
+	}
+
+	labeled := make([]map[string]any, len(prices))
+	for i, p := range prices {
+		label, _ := p["label"].(string)
+		amount, ok, err := intArg(p, "amount")
+		if err != nil || !ok || amount <= 0 {
+			return invalidArgs("prices[%d].amount must be a positive integer in the smallest currency unit", i)
+		}
+		if label == "" {
+			return invalidArgs("prices[%d].label is required", i)
+		}
+		labeled[i] = map[string]any{"label": label, "amount": amount}
+	}
+	encoded, err := json.Marshal(labeled)
+	if err != nil {
+		return fail(err)
+	}
+
+	form := url.Values{}
+	form.Set("chat_id", chatID)
+	form.Set("title", title)
+	form.Set("description", description)
+	form.Set("payload", payload)
+	form.Set("currency", currency)
+	form.Set("prices", string(encoded))
+	if providerToken != "" {
+		form.Set("provider_token", providerToken)
+	}
+
+	var sent message
+	if err := callTelegram(ctx, token, "sendInvoice", form, &sent); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"messageID": strconv.FormatInt(sent.MessageID, 10)})
+}
+
+// handleAnswerPreCheckoutQuery confirms or rejects an order after the user
+// has entered payment details. Telegram cancels the payment unless this is
+// answered within 10 seconds of the pre_checkout_query update.
+func (t *TelegramPlugin) handleAnswerPreCheckoutQuery(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	queryID, _ := args["preCheckoutQueryID"].(string)
+	ok, hasOK, err := boolArg(args, "ok")
+	if err != nil {
+		return fail(err)
+	}
+	errorMessage, _ := args["errorMessage"].(string)
+
+	if token == "" || queryID == "" || !hasOK {
+		return invalidArgs("token, preCheckoutQueryID and ok are required")
+	}
+	if !ok && errorMessage == "" {
+		return invalidArgs("errorMessage is required when ok is false")
+	}
+
+	form := url.Values{}
+	form.Set("pre_checkout_query_id", queryID)
+	form.Set("ok", strconv.FormatBool(ok))
+	if !ok {
+		form.Set("error_message", errorMessage)
+	}
+
+	if err := callTelegram(ctx, token, "answerPreCheckoutQuery", form, nil); err != nil {
+		return fail(err)
+	}
+	return succeed(nil)
+}
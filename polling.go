@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+const (
+	// pollTimeout is how long, in seconds, Telegram holds a getUpdates call
+	// open waiting for updates.
+	pollTimeout = 30
+	// pollMaxBackoff caps the wait between failed getUpdates calls or
+	// callback deliveries.
+	pollMaxBackoff = 30 * time.Second
+	// callbackTimeout bounds one POST of an update to the callback URL.
+	callbackTimeout = 10 * time.Second
+)
+
+// poller is a running StartPolling loop.
+type poller struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// pollerSet tracks the polling loops of one plugin.
+type pollerSet struct {
+	mu sync.Mutex
+	// running holds the loop of each bot, by token. Telegram allows one
+	// getUpdates consumer per bot.
+	running map[string]*poller
+	// offsets is the next update_id to deliver for each bot. It outlives
+	// StopPolling so a later StartPolling does not repeat updates.
+	offsets map[string]int64
+	// offsetFile, set by --offset-file, keeps the offsets across restarts,
+	// by bot ID so the file holds no tokens. saved is its contents.
+	offsetFile string
+	saved      map[string]int64
+}
+
+func newPollerSet() *pollerSet {
+	return &pollerSet{running: map[string]*poller{}, offsets: map[string]int64{}}
+}
+
+// handleStartPolling starts long-polling getUpdates in the background and
+// POSTs each update, as the same JSON Telegram would send a webhook, to
+// callbackURL. An update is only marked as read once the callback answers
+// with a 2xx status, so delivery is at least once. With --offset-file the
+// first StartPolling after a restart resumes where the last run stopped.
+func (t *TelegramPlugin) handleStartPolling(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	callbackURL, _ := args["callbackURL"].(string)
+	secret, _ := args["secretToken"].(string)
+	allowed, err := stringsArg(args, "allowedUpdates")
+	if err != nil {
+		return fail(err)
+	}
+
+	if token == "" || callbackURL == "" {
+		return invalidArgs("token and callbackURL are required")
+	}
+	if u, err := url.Parse(callbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidArgs("callbackURL must be an absolute http or https URL")
+	}
+
+	form := url.Values{}
+	form.Set("timeout", strconv.Itoa(pollTimeout))
+	if allowed != nil {
+		encoded, err := json.Marshal(allowed)
+		if err != nil {
+			return fail(err)
+		}
+		form.Set("allowed_updates", string(encoded))
+	}
+
+	ps := t.state.pollers
+	ps.mu.Lock()
+	running := ps.running[token] != nil
+	ps.mu.Unlock()
+	if running {
+		return invalidArgs("this bot is already polling; call StopPolling first")
+	}
+
+	// getUpdates fails while a webhook is set; say so now rather than from
+	// inside the loop. This also rejects a bad token up front.
+	var hook struct {
+		URL string `json:"url"`
+	}
+	if err := callTelegram(ctx, token, "getWebhookInfo", url.Values{}, &hook); err != nil {
+		return fail(err)
+	}
+	if hook.URL != "" {
+		return invalidArgs("a webhook is set for this bot; call DeleteWebhook before StartPolling")
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.running[token] != nil {
+		return invalidArgs("this bot is already polling; call StopPolling first")
+	}
+	loopCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	p := &poller{cancel: cancel, done: make(chan struct{})}
+	ps.running[token] = p
+	if _, ok := ps.offsets[token]; !ok {
+		if saved, ok := ps.saved[botID(token)]; ok {
+			ps.offsets[token] = saved
+		}
+	}
+	go p.run(loopCtx, ps, token, form, callbackURL, secret)
+
+	return succeed(map[string]any{"polling": true, "offset": ps.offsets[token]})
+}
+
+// handleStopPolling stops the bot's polling loop and confirms the updates it
+// delivered with Telegram, so they are not returned to the next consumer.
+func (t *TelegramPlugin) handleStopPolling(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+
+	offset, stopped := t.state.pollers.stop(token)
+	if !stopped {
+		return succeed(map[string]any{"stopped": false})
+	}
+	if err := confirmOffset(ctx, token, offset); err != nil {
+		return fail(err)
+	}
+	return succeed(map[string]any{"stopped": true, "offset": offset})
+}
+
+// stop cancels token's loop and waits for it to exit, returning the offset
+// it reached.
+func (ps *pollerSet) stop(token string) (int64, bool) {
+	ps.mu.Lock()
+	p := ps.running[token]
+	delete(ps.running, token)
+	ps.mu.Unlock()
+	if p == nil {
+		return 0, false
+	}
+
+	p.cancel()
+	<-p.done
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.offsets[token], true
+}
+
+// stopAll stops every polling loop on shutdown.
+func (ps *pollerSet) stopAll(ctx context.Context) {
+	ps.mu.Lock()
+	tokens := make([]string, 0, len(ps.running))
+	for token := range ps.running {
+		tokens = append(tokens, token)
+	}
+	ps.mu.Unlock()
+
+	for _, token := range tokens {
+		if offset, ok := ps.stop(token); ok {
+			if err := confirmOffset(ctx, token, offset); err != nil {
+				logger.Warn("failed to confirm polled updates", "error", err.Error())
+			}
+		}
+	}
+}
+
+// confirmOffset tells Telegram every update before offset was handled.
+// getUpdates only forgets updates when asked for a later offset.
+func confirmOffset(ctx context.Context, token string, offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+	form := url.Values{}
+	form.Set("offset", strconv.FormatInt(offset, 10))
+	form.Set("limit", "1")
+	form.Set("timeout", "0")
+	return callTelegram(ctx, token, "getUpdates", form, nil)
+}
+
+func (p *poller) run(ctx context.Context, ps *pollerSet, token string, form url.Values, callbackURL, secret string) {
+	defer close(p.done)
+
+	client := &http.Client{Timeout: callbackTimeout}
+	var backoff time.Duration
+	for {
+		if backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+
+		ps.mu.Lock()
+		offset := ps.offsets[token]
+		ps.mu.Unlock()
+
+		req := url.Values{}
+		for k, v := range form {
+			req[k] = v
+		}
+		if offset != 0 {
+			req.Set("offset", strconv.FormatInt(offset, 10))
+		}
+
+		var updates []json.RawMessage
+		err := callTelegram(ctx, token, "getUpdates", req, &updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			backoff = nextPollBackoff(backoff, err)
+			logger.Warn("getUpdates failed", "error", err.Error(), "retryIn", backoff.String())
+			continue
+		}
+		backoff = 0
+
+		for _, raw := range updates {
+			var head struct {
+				UpdateID int64 `json:"update_id"`
+			}
+			if err := json.Unmarshal(raw, &head); err != nil || head.UpdateID < offset {
+				continue
+			}
+			if err := postUpdate(ctx, client, callbackURL, secret, raw); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				// getUpdates returns this update again on the next round.
+				backoff = nextPollBackoff(backoff, err)
+				logger.Warn("update delivery failed", "updateID", head.UpdateID, "error", err.Error(), "retryIn", backoff.String())
+				break
+			}
+			offset = head.UpdateID + 1
+			ps.setOffset(token, offset)
+		}
+	}
+}
+
+// setOffset records that every update before offset was delivered, and
+// saves it to the offset file if there is one.
+func (ps *pollerSet) setOffset(token string, offset int64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.offsets[token] = offset
+	if ps.offsetFile == "" {
+		return
+	}
+	ps.saved[botID(token)] = offset
+	if err := ps.saveOffsets(); err != nil {
+		logger.Warn("failed to save polling offset", "error", err.Error())
+	}
+}
+
+// loadOffsets reads the offsets saved by a previous run from path and saves
+// later ones there. A missing or unreadable file starts every bot fresh.
+func (ps *pollerSet) loadOffsets(path string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.offsetFile = path
+	ps.saved = map[string]int64{}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("no polling offset file yet, starting fresh", "file", path)
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(raw, &ps.saved)
+	}
+	if err != nil {
+		logger.Warn("unreadable polling offset file, starting fresh", "file", path, "error", err.Error())
+		ps.saved = map[string]int64{}
+	}
+}
+
+// saveOffsets replaces the offset file atomically. ps.mu must be held.
+func (ps *pollerSet) saveOffsets() error {
+	encoded, err := json.Marshal(ps.saved)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(ps.offsetFile), ".offsets-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(encoded); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), ps.offsetFile)
+}
+
+// botID is the bot's numeric ID, the part of its token before the colon,
+// which identifies the bot without giving access to it.
+func botID(token string) string {
+	if id, _, ok := strings.Cut(token, ":"); ok {
+		if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return id
+		}
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// postUpdate delivers one update to the callback URL, with the secret, if
+// any, in the header Telegram uses for webhooks.
+func postUpdate(ctx context.Context, client *http.Client, callbackURL, secret string, update []byte) error {
+	req, err := newRequest(ctx, http.MethodPost, callbackURL, "application/json", bytes.NewReader(update))
+	if err != nil {
+		return err
+	}
+	if secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post update: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback answered %s", resp.Status)
+	}
+	return nil
+}
+
+// nextPollBackoff doubles the previous wait, starting at one second, unless
+// Telegram said how long to wait.
+func nextPollBackoff(prev time.Duration, err error) time.Duration {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	if prev == 0 {
+		return time.Second
+	}
+	return min(2*prev, pollMaxBackoff)
+}
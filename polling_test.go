@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOffsetFileSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.json")
+
+	ps := newPollerSet()
+	ps.loadOffsets(path)
+	ps.setOffset("123:SECRET", 42)
+	ps.setOffset("456:OTHER", 7)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]int64
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		t.Fatal(err)
+	}
+	// Offsets are kept by bot ID, so the file holds no tokens.
+	if saved["123"] != 42 || saved["456"] != 7 || len(saved) != 2 {
+		t.Errorf("offset file = %s", raw)
+	}
+
+	restarted := newPollerSet()
+	restarted.loadOffsets(path)
+	if restarted.saved["123"] != 42 {
+		t.Errorf("offset after restart = %d, want 42", restarted.saved["123"])
+	}
+}
+
+func TestStartPollingResumesSavedOffset(t *testing.T) {
+	p, _ := newStubbedPlugin(t)
+	path := filepath.Join(t.TempDir(), "offsets.json")
+	os.WriteFile(path, []byte(`{"123": 42}`), 0o600)
+	p.state.pollers.loadOffsets(path)
+
+	callback := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer callback.Close()
+	if data := call(t, p, "StartPolling", map[string]any{"token": "123:T", "callbackURL": callback.URL}); data["offset"] != int64(42) {
+		t.Errorf("StartPolling offset = %v, want 42", data["offset"])
+	}
+	p.state.pollers.stopAll(context.Background())
+}
+
+func TestOffsetFileMissingOrCorrupt(t *testing.T) {
+	for name, content := range map[string]*string{
+		"missing":     nil,
+		"corrupt":     ptr("{not json"),
+		"wrong shape": ptr(`["123"]`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "offsets.json")
+			if content != nil {
+				os.WriteFile(path, []byte(*content), 0o600)
+			}
+			ps := newPollerSet()
+			ps.loadOffsets(path)
+			if len(ps.saved) != 0 {
+				t.Errorf("saved = %v, want none", ps.saved)
+			}
+
+			// The next offset replaces the file with a valid one.
+			ps.setOffset("123:T", 5)
+			restarted := newPollerSet()
+			restarted.loadOffsets(path)
+			if restarted.saved["123"] != 5 {
+				t.Errorf("offset after rewrite = %d, want 5", restarted.saved["123"])
+			}
+		})
+	}
+}
+
+func TestOffsetFileWrittenAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "offsets.json")
+	ps := newPollerSet()
+	ps.loadOffsets(path)
+	ps.setOffset("123:T", 1)
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps.setOffset("123:T", 2)
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A rename puts a new file in place; writing in place would keep it.
+	if os.SameFile(before, after) {
+		t.Error("offset file was rewritten in place")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files in the directory, want only the offset file", len(files))
+	}
+
+	// A failed save leaves no temp file behind.
+	os.Remove(path)
+	os.Mkdir(path, 0o700)
+	ps.setOffset("123:T", 3)
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files left after a failed save, want 1", len(files))
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// userAgent identifies the plugin on every Bot API request. main() lets
+// --user-agent replace it.
+var userAgent = "orka-telegram-plugin/" + strings.TrimPrefix(pluginVersion, "v")
+
+type requestIDKey struct{}
+
+// withRequestID returns a context whose Bot API requests carry id as their
+// X-Request-ID header.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type correlationIDKey struct{}
+
+// withCorrelationID returns a context whose log lines and Bot API requests
+// carry the caller's _correlationID, which ties together the calls one
+// workflow makes to different plugins.
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+func correlationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// maxCallIDLength bounds requestID and _correlationID, which are copied
+// into every log line and request header of the call.
+const maxCallIDLength = 128
+
+// callIDArg reads requestID or _correlationID, which must fit in an HTTP
+// header.
+func callIDArg(args map[string]any, key string) (string, error) {
+	v, present := args[key]
+	id, ok := v.(string)
+	if present && v != nil && !ok {
+		return "", argErrorf("%s must be a string", key)
+	}
+	if len(id) > maxCallIDLength {
+		return "", argErrorf("%s must be at most %d bytes", key, maxCallIDLength)
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x20 || id[i] == 0x7f {
+			return "", argErrorf("%s must not contain control characters", key)
+		}
+	}
+	return id, nil
+}
+
+// callAttrs are the log attributes naming the call ctx belongs to.
+func callAttrs(ctx context.Context) []any {
+	attrs := []any{"requestID", requestIDFrom(ctx)}
+	if id := correlationIDFrom(ctx); id != "" {
+		attrs = append(attrs, "correlationID", id)
+	}
+	return attrs
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// echoCallIDs adds the call's request and correlation IDs to res.Data so
+// callers can match a response to the plugin's and their egress proxy's
+// logs.
+func echoCallIDs(ctx context.Context, res *sdk.Response) {
+	switch data := res.Data.(type) {
+	case nil:
+		res.Data = map[string]any{"requestID": requestIDFrom(ctx), "correlationID": correlationIDFrom(ctx)}
+	case map[string]any:
+		data["requestID"] = requestIDFrom(ctx)
+		data["correlationID"] = correlationIDFrom(ctx)
+	}
+}
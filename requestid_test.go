@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+func TestCallMethodRejectsInvalidCallIDs(t *testing.T) {
+	p := newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL))
+	for _, key := range []string{"requestID", "_correlationID"} {
+		for name, id := range map[string]any{
+			"too long":         strings.Repeat("a", maxCallIDLength+1),
+			"newline":          "abc\r\nX-Injected: 1",
+			"delete character": "abc\x7f",
+			"not a string":     42,
+		} {
+			t.Run(key+"/"+name, func(t *testing.T) {
+				var res sdk.Response
+				if err := p.CallMethod(sdk.Request{Method: "Version", Args: map[string]any{key: id}}, &res); err != nil {
+					t.Fatalf("CallMethod: %v", err)
+				}
+				data, _ := res.Data.(map[string]any)
+				if res.Success || data["errorCode"] != codeInvalidArgs {
+					t.Fatalf("got Success=%v errorCode=%v, want INVALID_ARGS", res.Success, data["errorCode"])
+				}
+				if data["requestID"] == id || data["correlationID"] == id {
+					t.Error("invalid ID echoed back")
+				}
+			})
+		}
+	}
+
+	var res sdk.Response
+	if err := p.CallMethod(sdk.Request{Method: "Version", Args: map[string]any{"requestID": "req-1"}}, &res); err != nil {
+		t.Fatalf("CallMethod: %v", err)
+	}
+	if data, _ := res.Data.(map[string]any); !res.Success || data["requestID"] != "req-1" {
+		t.Errorf("valid requestID: Success=%v requestID=%v", res.Success, data["requestID"])
+	}
+}
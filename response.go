@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// Error codes reported in res.Data["errorCode"] on failed calls. They are
+// part of the plugin's contract: callers branch on them for retry and
+// alerting, so existing values must not change.
+const (
+	codeInvalidArgs         = "INVALID_ARGS"
+	codeUnknownMethod       = "UNKNOWN_METHOD"
+	codeLimitExceeded       = "LIMIT_EXCEEDED"
+	codeChatNotPermitted    = "CHAT_NOT_PERMITTED"
+	codeUnverifiedUpdate    = "UNVERIFIED_UPDATE"
+	codeUpstreamBadRequest  = "UPSTREAM_BAD_REQUEST"
+	codeUpstreamAuth        = "UPSTREAM_AUTH"
+	codeUpstreamForbidden   = "UPSTREAM_FORBIDDEN"
+	codeUpstreamRateLimit   = "UPSTREAM_RATE_LIMIT"
+	codeUpstreamError       = "UPSTREAM_ERROR"
+	codeUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+	codeTimeout             = "TIMEOUT"
+	codeInternal            = "INTERNAL"
+)
+
+// argError is a missing or malformed request argument.
+type argError struct {
+	msg string
+}
+
+func (e *argError) Error() string { return e.msg }
+
+func argErrorf(format string, a ...any) error {
+	return &argError{msg: fmt.Sprintf(format, a...)}
+}
+
+// errTooLarge marks content refused for exceeding a size limit.
+var errTooLarge = errors.New("size limit exceeded")
+
+// errChatNotPermitted marks a send refused by --allowed-chats.
+var errChatNotPermitted = errors.New("chat not permitted")
+
+// errUnverifiedUpdate marks an update whose webhook secret did not match.
+var errUnverifiedUpdate = errors.New("webhook secret does not match")
+
+// errUnconfirmed marks a send Telegram answered with ok=true but without a
+// plausible message, so it cannot be counted as delivered.
+var errUnconfirmed = errors.New("delivery not confirmed")
+
+func succeed(data map[string]any) sdk.Response {
+	if data == nil {
+		return sdk.Response{Success: true}
+	}
+	return sdk.Response{Success: true, Data: data}
+}
+
+// fail builds an error response, classifying err into an error code. Rate
+// limited calls also report how many seconds Telegram asked us to wait.
+func fail(err error) sdk.Response {
+	data := map[string]any{"errorCode": errorCode(err)}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		data["retryAfter"] = apiErr.RetryAfter
+	}
+	return sdk.Response{Success: false, Error: err.Error(), Data: data}
+}
+
+func invalidArgs(format string, a ...any) sdk.Response {
+	return fail(argErrorf(format, a...))
+}
+
+func errorCode(err error) string {
+	var argErr *argError
+	if errors.As(err, &argErr) {
+		return codeInvalidArgs
+	}
+	if errors.Is(err, errTooLarge) {
+		return codeLimitExceeded
+	}
+	if errors.Is(err, errChatNotPermitted) {
+		return codeChatNotPermitted
+	}
+	if errors.Is(err, errUnverifiedUpdate) {
+		return codeUnverifiedUpdate
+	}
+	if errors.Is(err, errUnconfirmed) {
+		return codeUpstreamError
+	}
+
+	var permErr *permissionError
+	if errors.As(err, &permErr) {
+		return codeUpstreamForbidden
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == 400:
+			return codeUpstreamBadRequest
+		case apiErr.Code == 401 || apiErr.Code == 404:
+			// Telegram answers 404 for malformed tokens and 401 for
+			// revoked ones.
+			return codeUpstreamAuth
+		case apiErr.Code == 403:
+			return codeUpstreamForbidden
+		case apiErr.Code == 429:
+			return codeUpstreamRateLimit
+		default:
+			return codeUpstreamError
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return codeTimeout
+		}
+		return codeUpstreamUnavailable
+	}
+	return codeInternal
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorCode(t *testing.T) {
+	api := func(code int) error { return &apiError{Method: "sendMessage", Code: code, Description: "x"} }
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"bad args", argErrorf("x is required"), codeInvalidArgs},
+		{"wrapped bad args", fmt.Errorf("media[0]: %w", argErrorf("x")), codeInvalidArgs},
+		{"too large", fmt.Errorf("file: %w", errTooLarge), codeLimitExceeded},
+		{"chat not permitted", fmt.Errorf("%w: 1", errChatNotPermitted), codeChatNotPermitted},
+		{"unverified update", errUnverifiedUpdate, codeUnverifiedUpdate},
+		{"unconfirmed", fmt.Errorf("no date: %w", errUnconfirmed), codeUpstreamError},
+		{"400", api(400), codeUpstreamBadRequest},
+		{"401", api(401), codeUpstreamAuth},
+		{"404", api(404), codeUpstreamAuth},
+		{"403", api(403), codeUpstreamForbidden},
+		{"permission", &permissionError{action: "ban", err: api(400).(*apiError)}, codeUpstreamForbidden},
+		{"429", api(429), codeUpstreamRateLimit},
+		{"409", api(409), codeUpstreamError},
+		{"500", api(500), codeUpstreamError},
+		{"wrapped API error", fmt.Errorf("part 2: %w", api(429)), codeUpstreamRateLimit},
+		{"timeout", requestError(timeoutError{}), codeTimeout},
+		{"unreachable", requestError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}), codeUpstreamUnavailable},
+		{"other", errors.New("boom"), codeInternal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := errorCode(tc.err); got != tc.want {
+				t.Errorf("errorCode(%v) = %s, want %s", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFailReportsRetryAfter(t *testing.T) {
+	res := fail(&apiError{Method: "sendMessage", Code: 429, Description: "Too Many Requests", RetryAfter: 30})
+	data := res.Data.(map[string]any)
+	if res.Success || data["errorCode"] != codeUpstreamRateLimit || data["retryAfter"] != 30 {
+		t.Errorf("fail = %+v", res)
+	}
+	if data := fail(errors.New("boom")).Data.(map[string]any); data["retryAfter"] != nil {
+		t.Errorf("retryAfter = %v for a non-rate-limit error", data["retryAfter"])
+	}
+}
+
+// The codes reach callers unchanged from what Telegram answers.
+func TestTelegramErrorCodes(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	args := map[string]any{"token": "1:T", "chatID": "1", "text": "hi"}
+	for _, tc := range []struct {
+		status int64
+		want   string
+	}{
+		{400, codeUpstreamBadRequest},
+		{401, codeUpstreamAuth},
+		{403, codeUpstreamForbidden},
+		{404, codeUpstreamAuth},
+		{429, codeUpstreamRateLimit},
+		{500, codeUpstreamError},
+	} {
+		stub.errorCode.Store(tc.status)
+		res := callRaw(t, p, "SendMessage", args)
+		data, _ := res.Data.(map[string]any)
+		if res.Success || data["errorCode"] != tc.want {
+			t.Errorf("Telegram %d: Success=%v errorCode=%v, want %s", tc.status, res.Success, data["errorCode"], tc.want)
+		}
+		if tc.status == 429 && data["retryAfter"] != 7 {
+			t.Errorf("Telegram 429: retryAfter = %v, want 7", data["retryAfter"])
+		}
+	}
+}
+
+func TestTelegramUnreachable(t *testing.T) {
+	p, _ := newStubbedPlugin(t)
+	closed := httptest.NewServer(nil)
+	closed.Close()
+	telegramAPIBase = closed.URL
+
+	res := callRaw(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": "hi"})
+	if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeUpstreamUnavailable {
+		t.Errorf("Success=%v errorCode=%v, want %s", res.Success, data["errorCode"], codeUpstreamUnavailable)
+	}
+}
+
+func TestTelegramTimeout(t *testing.T) {
+	newStubbedPlugin(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err := callTelegram(ctx, "1:T", "getMe", nil, nil)
+	if errorCode(err) != codeTimeout {
+		t.Errorf("errorCode(%v) = %s, want %s", err, errorCode(err), codeTimeout)
+	}
+}
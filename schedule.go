@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// maxScheduled bounds how many SendMessage calls with scheduleAt can be
+// waiting at once.
+const maxScheduled = 1000
+
+type scheduledMessage struct {
+	token string
+	timer *time.Timer
+}
+
+// scheduler holds one plugin's pending messages by scheduledID. They are in
+// memory only and are lost when the plugin exits.
+type scheduler struct {
+	mu      sync.Mutex
+	pending map[string]*scheduledMessage
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{pending: map[string]*scheduledMessage{}}
+}
+
+// schedule runs send at the given time and returns the scheduledID that
+// CancelScheduled takes. The outcome of the send is only logged.
+func (s *scheduler) schedule(ctx context.Context, token string, at time.Time, send func(context.Context) sdk.Response) sdk.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) >= maxScheduled {
+		return fail(fmt.Errorf("%d messages are already scheduled: %w", maxScheduled, errTooLarge))
+	}
+
+	id := newRequestID()
+	sendCtx := context.WithoutCancel(ctx)
+	s.pending[id] = &scheduledMessage{token: token, timer: time.AfterFunc(time.Until(at), func() {
+		s.mu.Lock()
+		_, pending := s.pending[id]
+		delete(s.pending, id)
+		s.mu.Unlock()
+		if !pending {
+			return
+		}
+
+		res := send(sendCtx)
+		if !res.Success {
+			logger.Error("scheduled message failed", append([]any{"scheduledID", id, "error", res.Error}, callAttrs(sendCtx)...)...)
+			return
+		}
+		logger.Info("scheduled message sent", append([]any{"scheduledID", id}, callAttrs(sendCtx)...)...)
+	})}
+
+	return succeed(map[string]any{"scheduledID": id, "scheduledAt": at.UTC().Format(time.RFC3339)})
+}
+
+// handleCancelScheduled drops a message scheduled with SendMessage's
+// scheduleAt. cancelled is false when it was already sent, or was not
+// scheduled with this token.
+func (t *TelegramPlugin) handleCancelScheduled(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	id, _ := args["scheduledID"].(string)
+	if token == "" || id == "" {
+		return invalidArgs("token and scheduledID are required")
+	}
+
+	s := t.state.scheduled
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.pending[id]
+	if m == nil || m.token != token {
+		return succeed(map[string]any{"cancelled": false})
+	}
+	m.timer.Stop()
+	delete(s.pending, id)
+	return succeed(map[string]any{"cancelled": true})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxArgsBytes caps the combined size of string and byte arguments in one
+// call. It leaves room for a 50 MB upload sent as base64.
+const maxArgsBytes = 100 << 20
+
+//go:embed config.json
+var configJSON []byte
+
+// pluginVersion is config.json's version. argTypes maps method name to
+// argument name to the type config.json declares for it, so the published
+// contract is also what gets enforced.
+var pluginVersion, argTypes = loadConfig(configJSON)
+
+// strictArgs, set by --strict-args, makes checkArgs reject arguments the
+// method does not declare, which are otherwise ignored.
+var strictArgs bool
+
+// commonArgs are accepted by every method without being declared.
+var commonArgs = []string{"requestID", "_trace", "_correlationID"}
+
+// looseArgs lists the arguments whose handlers accept more than the single
+// type config.json can express. Keys are "Method.arg" or just "arg".
+var looseArgs = map[string][]string{
+	"SendMessage.chatID": {"array"},
+	"fromChatID":         {"number"},
+	"userID":             {"number"},
+	"messageID":          {"number"},
+	"messageThreadID":    {"number"},
+	"data":               {"bytes"},
+	"voiceData":          {"bytes"},
+	"thumbnail":          {"bytes"},
+	"replyMarkup":        {"string"},
+	"update":             {"string"},
+}
+
+func loadConfig(raw []byte) (string, map[string]map[string]string) {
+	var cfg struct {
+		Version string `json:"version"`
+		Methods map[string]struct {
+			Args []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"args"`
+		} `json:"methods"`
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		panic(fmt.Sprintf("invalid embedded config.json: %v", err))
+	}
+
+	types := make(map[string]map[string]string, len(cfg.Methods))
+	for method, spec := range cfg.Methods {
+		types[method] = make(map[string]string, len(spec.Args))
+		for _, arg := range spec.Args {
+			types[method][arg.Name] = arg.Type
+		}
+	}
+	return cfg.Version, types
+}
+
+// checkArgs rejects arguments of the wrong type before a handler can
+// mistake them for absent ones, and calls whose arguments are too large.
+// Arguments config.json does not declare are left to the handler unless
+// strictArgs is set.
+func checkArgs(method string, args map[string]any) error {
+	declared := argTypes[method]
+	if strictArgs && declared != nil {
+		if err := checkUnknownArgs(declared, args); err != nil {
+			return err
+		}
+	}
+	for name, v := range args {
+		want, ok := declared[name]
+		if !ok || v == nil {
+			continue
+		}
+		got := argKind(v)
+		if got == want || acceptsLoose(method, name, got) {
+			continue
+		}
+		// Numbers often arrive as text from callers that build args from
+		// templates or form input.
+		if str, ok := v.(string); ok && want == "number" {
+			if _, ok := parseNumber(str); ok {
+				continue
+			}
+			return argErrorf("arg %q must be a number, got %q", name, str)
+		}
+		return argErrorf("arg %q must be %s, got %s", name, article(want), got)
+	}
+
+	if n := argsSize(args); n > maxArgsBytes {
+		return fmt.Errorf("arguments are %d bytes, exceeds %d: %w", n, maxArgsBytes, errTooLarge)
+	}
+	return nil
+}
+
+// checkUnknownArgs rejects the first, in sorted order, of the arguments that
+// are neither declared nor common, suggesting the closest known name.
+func checkUnknownArgs(declared map[string]string, args map[string]any) error {
+	var unknown []string
+	for name := range args {
+		if _, ok := declared[name]; !ok && !isCommonArg(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	name := unknown[0]
+	known := append([]string(nil), commonArgs...)
+	for k := range declared {
+		known = append(known, k)
+	}
+	if match := suggestArg(name, known); match != "" {
+		return argErrorf("unknown argument %q; did you mean %q?", name, match)
+	}
+	return argErrorf("unknown argument %q", name)
+}
+
+func isCommonArg(name string) bool {
+	for _, c := range commonArgs {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestArg returns the known name closest to name, if any is within two
+// edits or differs only in case.
+func suggestArg(name string, known []string) string {
+	sort.Strings(known)
+	best, bestDist := "", 3
+	for _, k := range known {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(k)); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b, in bytes.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func acceptsLoose(method, name, kind string) bool {
+	for _, key := range []string{method + "." + name, name} {
+		for _, k := range looseArgs[key] {
+			if k == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// argKind names the type of a gob-decoded value in config.json's terms.
+func argKind(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "number"
+	case []byte:
+		return "bytes"
+	case []any, []string, []map[string]any:
+		return "array"
+	case map[string]any, map[string]string:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func article(kind string) string {
+	switch kind {
+	case "array", "object":
+		return "an " + kind
+	default:
+		return "a " + kind
+	}
+}
+
+// argsSize adds up the length of every string and byte slice in v.
+func argsSize(v any) int {
+	switch v := v.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case []string:
+		n := 0
+		for _, s := range v {
+			n += len(s)
+		}
+		return n
+	case []any:
+		n := 0
+		for _, e := range v {
+			n += argsSize(e)
+		}
+		return n
+	case []map[string]any:
+		n := 0
+		for _, m := range v {
+			n += argsSize(m)
+		}
+		return n
+	case map[string]any:
+		n := 0
+		for k, e := range v {
+			n += len(k) + argsSize(e)
+		}
+		return n
+	case map[string]string:
+		n := 0
+		for k, s := range v {
+			n += len(k) + len(s)
+		}
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// declareTestMethod adds a method with one argument of each declared type
+// to argTypes for one test.
+func declareTestMethod(t *testing.T) {
+	t.Helper()
+	argTypes["TestMethod"] = map[string]string{
+		"s": "string", "n": "number", "b": "boolean", "a": "array", "o": "object", "raw": "bytes",
+	}
+	t.Cleanup(func() { delete(argTypes, "TestMethod") })
+}
+
+func TestCheckArgsTypes(t *testing.T) {
+	declareTestMethod(t)
+	for _, tc := range []struct {
+		name string
+		arg  string
+		v    any
+		ok   bool
+	}{
+		{"string", "s", "x", true},
+		{"string given a number", "s", 1, false},
+		{"number int", "n", 1, true},
+		{"number int64", "n", int64(1), true},
+		{"number uint8", "n", uint8(1), true},
+		{"number float64", "n", 1.5, true},
+		{"number string", "n", "12", true},
+		{"number string with spaces", "n", " 12 ", true},
+		{"number fractional string", "n", "1.5", true},
+		{"number exponent string", "n", "1e19", true},
+		{"number non-numeric string", "n", "abc", false},
+		{"number NaN string", "n", "NaN", false},
+		{"number given a bool", "n", true, false},
+		{"boolean", "b", false, true},
+		{"boolean given a string", "b", "true", false},
+		{"array []any", "a", []any{1}, true},
+		{"array []string", "a", []string{"x"}, true},
+		{"array []map", "a", []map[string]any{{}}, true},
+		{"array given an object", "a", map[string]any{}, false},
+		{"object", "o", map[string]any{"k": 1}, true},
+		{"object map[string]string", "o", map[string]string{"k": "v"}, true},
+		{"object given an array", "o", []any{}, false},
+		{"bytes", "raw", []byte("x"), true},
+		{"bytes given a string", "raw", "eA==", false},
+		// nil counts as absent.
+		{"nil", "s", nil, true},
+		{"undeclared", "other", 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkArgs("TestMethod", map[string]any{tc.arg: tc.v})
+			if tc.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tc.ok && errorCode(err) != codeInvalidArgs {
+				t.Errorf("err = %v, want INVALID_ARGS", err)
+			}
+		})
+	}
+}
+
+func TestCheckArgsLoose(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		args   map[string]any
+	}{
+		{"SendMessage", map[string]any{"chatID": []any{"1", "2"}}},
+		{"SendPhoto", map[string]any{"data": []byte("x")}},
+		{"ForwardMessage", map[string]any{"fromChatID": 1, "messageID": 2}},
+	} {
+		if err := checkArgs(tc.method, tc.args); err != nil {
+			t.Errorf("%s(%v): %v", tc.method, tc.args, err)
+		}
+	}
+	if err := checkArgs("GetChat", map[string]any{"chatID": []any{"1"}}); err == nil {
+		t.Error("GetChat accepted a chatID array")
+	}
+}
+
+func TestCheckArgsSize(t *testing.T) {
+	err := checkArgs("SendPhoto", map[string]any{"data": make([]byte, maxArgsBytes+1)})
+	if !errors.Is(err, errTooLarge) {
+		t.Errorf("err = %v, want errTooLarge", err)
+	}
+}
+
+// Required arguments are left to the handler, which rejects them missing;
+// checkArgs only checks the types of those present.
+func TestRequiredAndOptionalArgs(t *testing.T) {
+	if err := checkArgs("SendMessage", map[string]any{}); err != nil {
+		t.Errorf("checkArgs rejected missing args: %v", err)
+	}
+
+	p, stub := newStubbedPlugin(t)
+	for _, args := range []map[string]any{
+		{"chatID": "1", "text": "hi"},
+		{"token": "1:T", "text": "hi"},
+		{"token": "1:T", "chatID": "1"},
+	} {
+		res := callRaw(t, p, "SendMessage", args)
+		if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+			t.Errorf("SendMessage(%v): Success=%v errorCode=%v, want INVALID_ARGS", args, res.Success, data["errorCode"])
+		}
+	}
+	call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": "hi"})
+	if got := stub.count("sendMessage"); got != 1 {
+		t.Errorf("sendMessage called %d times, want 1", got)
+	}
+}
+
+// A numeric string passes checkArgs as a number; whether it is a usable
+// integer is up to intArg.
+func TestNumericStringArgs(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	for _, tc := range []struct {
+		v  any
+		ok bool
+	}{
+		{"12", true},
+		{" 12 ", true},
+		{12.0, true},
+		{"1.5", false},
+		{"1e19", false},
+		{"abc", false},
+	} {
+		res := callRaw(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": "hi", "replyToMessageID": tc.v})
+		data, _ := res.Data.(map[string]any)
+		if tc.ok != res.Success || !tc.ok && data["errorCode"] != codeInvalidArgs {
+			t.Errorf("replyToMessageID %#v: Success=%v errorCode=%v", tc.v, res.Success, data["errorCode"])
+		}
+	}
+	if got := stub.count("sendMessage"); got != 3 {
+		t.Errorf("sendMessage called %d times, want 3", got)
+	}
+}
+
+// setStrictArgs sets --strict-args for one test.
+func setStrictArgs(t *testing.T) {
+	t.Helper()
+	saved := strictArgs
+	strictArgs = true
+	t.Cleanup(func() { strictArgs = saved })
+}
+
+func TestStrictArgs(t *testing.T) {
+	declareTestMethod(t)
+	setStrictArgs(t)
+
+	strictArgs = false
+	if err := checkArgs("TestMethod", map[string]any{"unknown": 1}); err != nil {
+		t.Errorf("unknown argument rejected without --strict-args: %v", err)
+	}
+
+	strictArgs = true
+	for _, tc := range []struct {
+		name string
+		args map[string]any
+		want string // the error, empty when accepted
+	}{
+		{"declared", map[string]any{"s": "x", "n": 1}, ""},
+		{"common", map[string]any{"requestID": "r", "_correlationID": "c", "_trace": map[string]any{}}, ""},
+		{"unknown", map[string]any{"zzzzz": 1}, `unknown argument "zzzzz"`},
+		{"suggested", map[string]any{"raww": 1}, `unknown argument "raww"; did you mean "raw"?`},
+		{"suggests common", map[string]any{"requestId": "r"}, `unknown argument "requestId"; did you mean "requestID"?`},
+		{"first in sorted order", map[string]any{"zzzzz": 1, "qqqqq": 2}, `unknown argument "qqqqq"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkArgs("TestMethod", tc.args)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("rejected: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.want || errorCode(err) != codeInvalidArgs {
+				t.Errorf("err = %v, want INVALID_ARGS %s", err, tc.want)
+			}
+		})
+	}
+
+	// Methods config.json does not declare are not checked.
+	if err := checkArgs("Undeclared", map[string]any{"anything": 1}); err != nil {
+		t.Errorf("undeclared method rejected: %v", err)
+	}
+}
+
+func TestSuggestArg(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		arg   string
+		known []string
+		want  string
+	}{
+		{"case only", "CHATID", []string{"chatID", "chat"}, "chatID"},
+		{"one edit", "chatId2", []string{"chatID2", "text"}, "chatID2"},
+		{"two edits", "txet", []string{"text"}, "text"},
+		{"three edits", "tquux", []string{"text"}, ""},
+		{"closest wins", "parseMod", []string{"parseModeX", "parseMode"}, "parseMode"},
+		// Equal distances go to the name first in sorted order.
+		{"tie", "cat", []string{"hat", "bat"}, "bat"},
+		{"none known", "text", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := suggestArg(tc.arg, tc.known); got != tc.want {
+				t.Errorf("suggestArg(%q, %v) = %q, want %q", tc.arg, tc.known, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"chatid", "chatid", 0},
+		{"token", "tokne", 2},
+	} {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Listen retries when the address is still held by a previous instance the
+// supervisor has not finished stopping.
+const listenAttempts = 5
+
+// listenBackoff is the wait before the first retry. Tests shorten it.
+var listenBackoff = 250 * time.Millisecond
+
+// listenWithRetry calls listen, retrying with exponential backoff while the
+// address is in use. Any other error is returned immediately.
+func listenWithRetry(port int, socket string) (net.Listener, error) {
+	delay := listenBackoff
+	for attempt := 1; ; attempt++ {
+		ln, err := listen(port, socket)
+		if err == nil || !errors.Is(err, syscall.EADDRINUSE) || attempt == listenAttempts {
+			return ln, err
+		}
+		logger.Warn("address in use, retrying listen",
+			"attempt", attempt,
+			"maxAttempts", listenAttempts,
+			"retryIn", delay.String(),
+		)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// listen opens the RPC listener. When socket is set the plugin listens on a
+// Unix domain socket readable only by the current user; otherwise it binds
+// to the given TCP port on localhost.
+func listen(port int, socket string) (net.Listener, error) {
+	if socket == "" {
+		return net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	}
+
+	// A socket file left behind by a crashed run would make Listen fail.
+	if fi, err := os.Lstat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(socket)
+	}
+
+	// Listen creates the socket with the umask applied; clearing the group
+	// and other bits closes the window before the Chmod below.
+	mask := syscall.Umask(0o177)
+	ln, err := net.Listen("unix", socket)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// codecs are the --codec values: how calls are encoded on a connection.
+// gob is what Orka uses; json serves JSON-RPC 1.0 for callers not written
+// in Go.
+var codecs = map[string]func(conn net.Conn){
+	"gob":  func(conn net.Conn) { rpc.ServeConn(conn) },
+	"json": func(conn net.Conn) { jsonrpc.ServeConn(conn) },
+}
+
+// server accepts RPC connections and keeps track of them so they can be
+// drained on shutdown instead of being reset mid-call.
+type server struct {
+	ln        net.Listener
+	serveConn func(conn net.Conn)
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+}
+
+func newServer(ln net.Listener, serveConn func(conn net.Conn)) *server {
+	return &server{ln: ln, serveConn: serveConn, conns: make(map[net.Conn]struct{})}
+}
+
+// serve accepts connections until the listener is closed.
+func (s *server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("RPC accept failed", "error", err.Error())
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// shutdown stops accepting connections and waits up to grace for in-flight
+// calls to complete. It reports whether every connection drained in time;
+// connections still open after the grace period are closed forcibly.
+func (s *server) shutdown(grace time.Duration) bool {
+	s.ln.Close()
+
+	// Closing only the read side stops new requests from arriving while
+	// letting the codec finish pending calls and write their replies.
+	s.mu.Lock()
+	for conn := range s.conns {
+		if cr, ok := conn.(interface{ CloseRead() error }); ok {
+			cr.CloseRead()
+		} else {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return false
+	}
+}
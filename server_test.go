@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+func TestListenSocketMode(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	// The umask must not loosen the socket's mode.
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	ln, err := listen(0, socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v, want a 0600 socket", fi.Mode())
+	}
+	if got := syscall.Umask(0); got != 0 {
+		t.Errorf("listen left the umask at %#o", got)
+	}
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	// A socket file whose listener is gone, as a crashed run leaves it.
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := os.Lstat(socket); err != nil {
+		t.Fatalf("stale socket missing: %v", err)
+	}
+
+	ln, err := listen(0, socket)
+	if err != nil {
+		t.Fatalf("listen over a stale socket: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListenKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.sock")
+	os.WriteFile(path, []byte("not a socket"), 0o600)
+
+	if ln, err := listen(0, path); err == nil {
+		ln.Close()
+		t.Fatal("listen replaced a regular file")
+	}
+	if raw, err := os.ReadFile(path); err != nil || string(raw) != "not a socket" {
+		t.Errorf("regular file changed: %q, %v", raw, err)
+	}
+}
+
+func TestListenTCPLoopback(t *testing.T) {
+	ln, err := listen(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if addr := ln.Addr().(*net.TCPAddr); !addr.IP.IsLoopback() {
+		t.Errorf("listening on %s, want loopback", addr)
+	}
+}
+
+// shortBackoff makes listenWithRetry retry quickly for one test.
+func shortBackoff(t *testing.T) {
+	saved := listenBackoff
+	listenBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { listenBackoff = saved })
+}
+
+func TestListenWithRetryWaitsForAddress(t *testing.T) {
+	shortBackoff(t)
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := held.Addr().(*net.TCPAddr).Port
+	// The previous instance lets go of the port after a few attempts.
+	time.AfterFunc(25*time.Millisecond, func() { held.Close() })
+
+	ln, err := listenWithRetry(port, "")
+	if err != nil {
+		t.Fatalf("listenWithRetry: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListenWithRetryGivesUp(t *testing.T) {
+	shortBackoff(t)
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	start := time.Now()
+	_, err = listenWithRetry(held.Addr().(*net.TCPAddr).Port, "")
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("err = %v, want EADDRINUSE", err)
+	}
+	// 10+20+40+80ms of backoff between the five attempts.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("gave up after %s, before retrying %d times", elapsed, listenAttempts)
+	}
+}
+
+func TestListenWithRetryFailsFast(t *testing.T) {
+	shortBackoff(t)
+	listenBackoff = time.Hour
+	_, err := listenWithRetry(0, filepath.Join(t.TempDir(), "missing", "plugin.sock"))
+	if err == nil || errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("err = %v, want a non-retryable error", err)
+	}
+}
+
+// slowService blocks each call until release is closed.
+type slowService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowService) Wait(arg int, reply *int) error {
+	s.started <- struct{}{}
+	<-s.release
+	*reply = arg + 1
+	return nil
+}
+
+// startSlowServer serves a slowService on a loopback listener.
+func startSlowServer(t *testing.T) (*server, *slowService, string) {
+	t.Helper()
+	svc := &slowService{started: make(chan struct{}, 1), release: make(chan struct{})}
+	rs := rpc.NewServer()
+	if err := rs.RegisterName("Slow", svc); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(ln, func(conn net.Conn) { rs.ServeConn(conn) })
+	go srv.serve()
+	return srv, svc, ln.Addr().String()
+}
+
+func TestShutdownFinishesInFlightCall(t *testing.T) {
+	srv, svc, addr := startSlowServer(t)
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	call := client.Go("Slow.Wait", 41, &reply, nil)
+	<-svc.started
+
+	stopped := make(chan bool)
+	go func() { stopped <- srv.shutdown(5 * time.Second) }()
+
+	// New connections are refused while the call drains.
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("still accepting connections during shutdown")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(svc.release)
+	<-call.Done
+	if call.Error != nil || reply != 42 {
+		t.Errorf("in-flight call = %d, %v; want 42, nil", reply, call.Error)
+	}
+	if !<-stopped {
+		t.Error("shutdown reported calls still in flight")
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	srv, svc, addr := startSlowServer(t)
+	defer close(svc.release)
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	call := client.Go("Slow.Wait", 1, &reply, nil)
+	<-svc.started
+
+	if srv.shutdown(50 * time.Millisecond) {
+		t.Error("shutdown reported a clean stop with a call still running")
+	}
+	<-call.Done
+	if call.Error == nil {
+		t.Error("call cut off by shutdown succeeded")
+	}
+}
+
+// registerPlugin registers a plugin with net/rpc's default server, which the
+// codecs serve, once for all tests.
+var registerPlugin = sync.OnceValue(func() error {
+	return rpc.Register(newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL)))
+})
+
+func TestCodecsRoundTrip(t *testing.T) {
+	newStubbedPlugin(t)
+	if err := registerPlugin(); err != nil {
+		t.Fatal(err)
+	}
+	clients := map[string]func(conn io.ReadWriteCloser) *rpc.Client{
+		"gob":  rpc.NewClient,
+		"json": jsonrpc.NewClient,
+	}
+	for name, serveConn := range codecs {
+		t.Run(name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := newServer(ln, serveConn)
+			go srv.serve()
+			defer srv.shutdown(time.Second)
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := clients[name](conn)
+			defer client.Close()
+
+			var res sdk.Response
+			req := sdk.Request{Method: "SendMessage", Args: map[string]any{"token": "1:T", "chatID": "1", "text": "hi", "requestID": "rt-1"}}
+			if err := client.Call("TelegramPlugin.CallMethod", req, &res); err != nil {
+				t.Fatalf("CallMethod: %v", err)
+			}
+			data, _ := res.Data.(map[string]any)
+			if !res.Success || data["messageID"] == nil || data["requestID"] != "rt-1" {
+				t.Errorf("response = %+v", res)
+			}
+
+			// Failures decode with their error code.
+			res = sdk.Response{}
+			if err := client.Call("TelegramPlugin.CallMethod", sdk.Request{Method: "NoSuchMethod", Args: map[string]any{}}, &res); err != nil {
+				t.Fatalf("CallMethod: %v", err)
+			}
+			if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeUnknownMethod {
+				t.Errorf("unknown method response = %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+const (
+	// spoolRetryInterval is how often the spool is retried while Telegram is
+	// reachable; failed rounds back off up to spoolMaxBackoff.
+	spoolRetryInterval = 5 * time.Second
+	spoolMaxBackoff    = 5 * time.Minute
+)
+
+// spooledMessage is a SendMessage that failed transiently, stored as one
+// JSON file until it is delivered. Parts holds what is still to send.
+type spooledMessage struct {
+	ID      string     `json:"id"`
+	Token   string     `json:"token"`
+	ChatID  string     `json:"chatID"`
+	Parts   []string   `json:"parts"`
+	Options url.Values `json:"options"`
+	// CacheKey is the idempotency cache key, recorded once delivered so a
+	// later retry of the original call is deduplicated.
+	CacheKey  string    `json:"cacheKey,omitempty"`
+	SentIDs   []string  `json:"sentIDs,omitempty"`
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// spool persists sends that failed while Telegram was unreachable in a
+// directory, and retries them in the background until they go through. The
+// files hold the bot token and message text, so the directory and files are
+// only accessible to the plugin's user.
+type spool struct {
+	dir  string
+	sent *idempotencyCache
+	// mu guards the files and inFlight. It is never held while sending, so
+	// add does not wait behind a flush.
+	mu sync.Mutex
+	// inFlight holds the IDs a flush is delivering, which other flushes skip.
+	inFlight map[string]bool
+}
+
+func openSpool(dir string, sent *idempotencyCache) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	return &spool{dir: dir, sent: sent, inFlight: map[string]bool{}}, nil
+}
+
+// spoolID names the spool entry of a send. Sends with an idempotency key
+// always get the same ID, so retrying the call does not spool it twice.
+func spoolID(chatID, key string) string {
+	if key == "" {
+		return newRequestID()
+	}
+	sum := sha256.Sum256([]byte(chatID + "\x00" + key))
+	return "k" + hex.EncodeToString(sum[:16])
+}
+
+// transientError reports whether a send failed because Telegram could not
+// be reached or was temporarily unable to serve it.
+func transientError(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 429 || apiErr.Code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (s *spool) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// has reports whether id is waiting in the spool.
+func (s *spool) has(id string) bool {
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+// add stores m. It reports false when an entry with the same ID is already
+// waiting.
+func (s *spool) add(m *spooledMessage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.has(m.ID) {
+		return false, nil
+	}
+	if err := s.write(m); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// save writes m under the lock.
+func (s *spool) save(m *spooledMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(m)
+}
+
+// write replaces m's file atomically, so a crash never leaves half an entry.
+func (s *spool) write(m *spooledMessage) error {
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(encoded); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	return os.Rename(f.Name(), s.path(m.ID))
+}
+
+// entries reads the waiting entries, oldest first.
+func (s *spool) entries() ([]*spooledMessage, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*spooledMessage
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spool entry: %w", err)
+		}
+		var m spooledMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			logger.Error("unreadable spool entry set aside", "file", filepath.Base(file), "error", err.Error())
+			os.Rename(file, strings.TrimSuffix(file, ".json")+".failed")
+			continue
+		}
+		out = append(out, &m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out, nil
+}
+
+// failedFor counts the entries of token's bot set aside as failed.
+func (s *spool) failedFor(token string) int {
+	files, _ := filepath.Glob(filepath.Join(s.dir, "*.failed"))
+	n := 0
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var m spooledMessage
+		if json.Unmarshal(raw, &m) == nil && m.Token == token {
+			n++
+		}
+	}
+	return n
+}
+
+// depth counts the entries still waiting and those set aside as failed.
+func (s *spool) depth() (pending, failed int) {
+	waiting, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	dead, _ := filepath.Glob(filepath.Join(s.dir, "*.failed"))
+	return len(waiting), len(dead)
+}
+
+// claim snapshots the waiting entries of token's bot, or of every bot when
+// token is empty, and marks them in flight. Entries another flush is
+// delivering are left out.
+func (s *spool) claim(token string) ([]*spooledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	var out []*spooledMessage
+	for _, m := range entries {
+		if (token == "" || m.Token == token) && !s.inFlight[m.ID] {
+			s.inFlight[m.ID] = true
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// release ends a flush's claim on m, removing its file when delivered or
+// setting it aside as .failed when Telegram rejected it.
+func (s *spool) release(m *spooledMessage, delivered, rejected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inFlight, m.ID)
+	switch {
+	case delivered:
+		os.Remove(s.path(m.ID))
+	case rejected:
+		s.write(m)
+		os.Rename(s.path(m.ID), filepath.Join(s.dir, m.ID+".failed"))
+	}
+}
+
+// flush tries to deliver the waiting entries of token's bot, or of every bot
+// when token is empty, in order. It stops at the first transient failure,
+// since later entries would fail the same way. Entries Telegram rejects
+// outright are renamed to .failed and logged.
+func (s *spool) flush(ctx context.Context, token string) (sent, remaining int, err error) {
+	entries, err := s.claim(token)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, m := range entries {
+		sendErr := s.deliver(ctx, m)
+		switch {
+		case sendErr == nil:
+			// Recorded before the file goes, so a retry of the original
+			// call always finds one or the other.
+			if m.CacheKey != "" {
+				s.sent.record(m.CacheKey, m.SentIDs)
+			}
+			s.release(m, true, false)
+			logger.Info("spooled message sent", "spoolID", m.ID, "attempts", m.Attempts)
+			sent++
+		case transientError(sendErr):
+			m.LastError = sendErr.Error()
+			err := s.save(m)
+			for _, left := range entries[i:] {
+				s.release(left, false, false)
+			}
+			if err != nil {
+				return sent, len(entries) - i, err
+			}
+			return sent, len(entries) - i, sendErr
+		default:
+			m.LastError = sendErr.Error()
+			s.release(m, false, true)
+			logger.Error("spooled message rejected, set aside", "spoolID", m.ID, "attempts", m.Attempts, "error", sendErr.Error())
+		}
+	}
+	return sent, 0, nil
+}
+
+// deliver sends m's remaining parts, saving progress after each so a crash
+// does not send a part twice.
+func (s *spool) deliver(ctx context.Context, m *spooledMessage) error {
+	m.Attempts++
+	for len(m.Parts) > 0 {
+		sent, err := sendTelegramMessage(ctx, m.Token, m.ChatID, m.Parts[0], m.Options)
+		if err != nil {
+			return err
+		}
+		m.SentIDs = append(m.SentIDs, strconv.FormatInt(sent.MessageID, 10))
+		m.Parts = m.Parts[1:]
+		m.Options.Del("message_effect_id")
+		if len(m.Parts) > 0 {
+			if err := s.save(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// run retries the spool until ctx ends: every spoolRetryInterval while that
+// works, and with doubling waits while Telegram stays unreachable. Entries
+// left from a previous run are retried on the first round.
+func (s *spool) run(ctx context.Context) {
+	wait := spoolRetryInterval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		sent, remaining, err := s.flush(ctx, "")
+		if err != nil && ctx.Err() == nil {
+			wait = min(2*wait, spoolMaxBackoff)
+			logger.Warn("spool retry failed", "sent", sent, "remaining", remaining, "error", err.Error(), "retryIn", wait.String())
+			continue
+		}
+		wait = spoolRetryInterval
+	}
+}
+
+// handleFlushSpool retries the spooled messages of token's bot now instead
+// of waiting for the background loop.
+func (t *TelegramPlugin) handleFlushSpool(ctx context.Context, args map[string]any) sdk.Response {
+	token, _ := args["token"].(string)
+	if token == "" {
+		return invalidArgs("token is required")
+	}
+	sp := t.state.spool
+	if sp == nil {
+		return invalidArgs("the spool is disabled; start the plugin with --spool-dir")
+	}
+	sent, remaining, err := sp.flush(ctx, token)
+	data := map[string]any{"sent": sent, "remaining": remaining, "failed": sp.failedFor(token)}
+	if err != nil {
+		data["lastError"] = err.Error()
+	}
+	return succeed(data)
+}
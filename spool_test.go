@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testEntry(id, token string) *spooledMessage {
+	return &spooledMessage{ID: id, Token: token, ChatID: "1", Parts: []string{"hello"}, Created: time.Now()}
+}
+
+// newStubbedSpool gives p a spool in a temp dir.
+func newStubbedSpool(t *testing.T, p *TelegramPlugin) *spool {
+	t.Helper()
+	sp, err := openSpool(t.TempDir(), p.state.sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.state.spool = sp
+	return sp
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(dir, newIdempotencyCache(10, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, err := sp.add(testEntry("a", "1:T")); !added || err != nil {
+		t.Fatalf("add = %v, %v", added, err)
+	}
+	if added, _ := sp.add(testEntry("a", "1:T")); added {
+		t.Error("same ID added twice")
+	}
+	if fi, err := os.Stat(sp.path("a")); err != nil || fi.Mode().Perm()&0o077 != 0 {
+		t.Errorf("spool file mode %v, err %v", fi.Mode(), err)
+	}
+
+	reopened, err := openSpool(dir, newIdempotencyCache(10, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := reopened.entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != "a" || entries[0].Token != "1:T" || entries[0].Parts[0] != "hello" {
+		t.Fatalf("entries after reopen = %+v", entries)
+	}
+}
+
+func TestSpoolFlush(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	sp := newStubbedSpool(t, p)
+
+	m := testEntry("a", "1:T")
+	m.CacheKey = "1\x00key"
+	sp.add(m)
+	sp.add(testEntry("b", "1:T"))
+
+	sent, remaining, err := sp.flush(context.Background(), "")
+	if sent != 2 || remaining != 0 || err != nil {
+		t.Fatalf("flush = %d, %d, %v; want 2, 0, nil", sent, remaining, err)
+	}
+	if pending, failed := sp.depth(); pending != 0 || failed != 0 {
+		t.Errorf("depth = %d, %d after flush", pending, failed)
+	}
+	// The delivered entry's key is now in the idempotency cache.
+	if data := call(t, p, "SendMessage", map[string]any{"token": "1:T", "chatID": "1", "text": "hello", "idempotencyKey": "key"}); data["deduplicated"] != true {
+		t.Errorf("retry after flush deduplicated = %v, want true", data["deduplicated"])
+	}
+	if got := stub.count("sendMessage"); got != 2 {
+		t.Errorf("sendMessage called %d times, want 2", got)
+	}
+}
+
+func TestSpoolFlushTransientFailure(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	sp := newStubbedSpool(t, p)
+	sp.add(testEntry("a", "1:T"))
+	stub.errorCode.Store(502)
+
+	sent, remaining, err := sp.flush(context.Background(), "")
+	if sent != 0 || remaining != 1 || err == nil {
+		t.Fatalf("flush = %d, %d, %v; want 0, 1 and an error", sent, remaining, err)
+	}
+	entries, _ := sp.entries()
+	if len(entries) != 1 || entries[0].Attempts != 1 || entries[0].LastError == "" {
+		t.Fatalf("entries after failed flush = %+v", entries)
+	}
+
+	// The entry is no longer in flight, so the next flush delivers it.
+	stub.errorCode.Store(0)
+	if sent, _, err := sp.flush(context.Background(), ""); sent != 1 || err != nil {
+		t.Errorf("second flush = %d, %v; want 1, nil", sent, err)
+	}
+}
+
+func TestSpoolFlushRejected(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	sp := newStubbedSpool(t, p)
+	sp.add(testEntry("a", "1:T"))
+	stub.errorCode.Store(400)
+
+	sent, remaining, err := sp.flush(context.Background(), "")
+	if sent != 0 || remaining != 0 || err != nil {
+		t.Fatalf("flush = %d, %d, %v; want 0, 0, nil", sent, remaining, err)
+	}
+	if _, err := os.Stat(filepath.Join(sp.dir, "a.failed")); err != nil {
+		t.Errorf("rejected entry not set aside: %v", err)
+	}
+	if pending, failed := sp.depth(); pending != 0 || failed != 1 {
+		t.Errorf("depth = %d, %d; want 0, 1", pending, failed)
+	}
+}
+
+func TestSendMessageSpoolsTransientFailure(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	newStubbedSpool(t, p)
+	args := map[string]any{"token": "1:T", "chatID": "1", "text": "hello", "idempotencyKey": "key"}
+
+	stub.errorCode.Store(503)
+	data := call(t, p, "SendMessage", args)
+	if data["spooled"] != true || data["spoolID"] != spoolID("1", "key") {
+		t.Fatalf("SendMessage = %v, want spooled", data)
+	}
+	if data := call(t, p, "SendMessage", args); data["spooled"] != true || data["deduplicated"] != true {
+		t.Errorf("retry while spooled = %v, want spooled and deduplicated", data)
+	}
+
+	stub.errorCode.Store(0)
+	if data := call(t, p, "FlushSpool", map[string]any{"token": "1:T"}); data["sent"] != 1 {
+		t.Errorf("FlushSpool sent = %v, want 1", data["sent"])
+	}
+	if data := call(t, p, "SendMessage", args); data["deduplicated"] != true {
+		t.Errorf("retry after flush deduplicated = %v, want true", data["deduplicated"])
+	}
+}
+
+func TestFlushSpoolScopedToToken(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+	sp := newStubbedSpool(t, p)
+	sp.add(testEntry("a", "1:A"))
+	sp.add(testEntry("b", "2:B"))
+
+	res := callRaw(t, p, "FlushSpool", map[string]any{})
+	if data, _ := res.Data.(map[string]any); res.Success || data["errorCode"] != codeInvalidArgs {
+		t.Fatalf("FlushSpool without token: Success=%v errorCode=%v", res.Success, data["errorCode"])
+	}
+
+	data := call(t, p, "FlushSpool", map[string]any{"token": "1:A"})
+	if data["sent"] != 1 || data["remaining"] != 0 || data["failed"] != 0 {
+		t.Errorf("FlushSpool = %v, want sent 1", data)
+	}
+	if !sp.has("b") || sp.has("a") {
+		t.Errorf("after flushing 1:A: has a = %v, has b = %v", sp.has("a"), sp.has("b"))
+	}
+	if got := stub.count("sendMessage"); got != 1 {
+		t.Errorf("sendMessage called %d times, want 1", got)
+	}
+}
+
+func TestSpoolRunStopsOnShutdown(t *testing.T) {
+	p, _ := newStubbedPlugin(t)
+	sp := newStubbedSpool(t, p)
+	p.state.background.run(context.Background(), sp.run)
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	p.state.background.stopAll(stopCtx)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("stopAll waited %s for the spool loop", elapsed)
+	}
+}
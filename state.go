@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults for the SendMessage idempotency cache, overridable with flags.
+const (
+	defaultIdempotencySize = 1000
+	defaultIdempotencyTTL  = 10 * time.Minute
+)
+
+// state is everything a TelegramPlugin keeps between calls. net/rpc runs
+// CallMethod on one goroutine per connection, so calls race on it; each
+// part guards itself with its own mutex and is only reached through its
+// methods. Process-wide resources that are not per plugin, such as
+// telegramClient, callMetrics and logger, stay package variables.
+type state struct {
+	// sent remembers SendMessage idempotency keys.
+	sent *idempotencyCache
+	// pollers holds running StartPolling loops and their offsets.
+	pollers *pollerSet
+	// scheduled holds messages waiting for their scheduleAt time.
+	scheduled *scheduler
+	// chats caches the numeric IDs of @username chats.
+	chats *chatCache
+	// topics caches the thread IDs of SendToTopic topics.
+	topics *topicCache
+	// spool holds sends waiting for Telegram to come back; nil unless
+	// --spool-dir is set.
+	spool *spool
+	// background runs work that outlives its call, such as repeated chat
+	// actions and the spool retry loop, until shutdown.
+	background *background
+}
+
+func newState(idempotencySize int, idempotencyTTL time.Duration) *state {
+	return &state{
+		sent:       newIdempotencyCache(idempotencySize, idempotencyTTL),
+		pollers:    newPollerSet(),
+		scheduled:  newScheduler(),
+		chats:      newChatCache(),
+		topics:     newTopicCache(),
+		background: newBackground(),
+	}
+}
+
+// background tracks goroutines that keep running after the call or setup
+// that started them returns, so shutdown can stop them and wait for them to
+// finish.
+type background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newBackground() *background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &background{ctx: ctx, cancel: cancel}
+}
+
+// run starts f in its own goroutine. f's context keeps the values of the
+// call's ctx, such as its request ID, but ends at shutdown rather than when
+// the call returns.
+func (b *background) run(ctx context.Context, f func(context.Context)) {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(b.ctx, cancel)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer cancel()
+		defer stop()
+		f(runCtx)
+	}()
+}
+
+// stopAll cancels every background goroutine on shutdown and waits for them
+// until ctx ends.
+func (b *background) stopAll(ctx context.Context) {
+	b.cancel()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("background work still running at shutdown")
+	}
+}
+
+// inProcessPlugin serves OrkaCall, which has no main() to set it up.
+var inProcessPlugin = sync.OnceValue(func() *TelegramPlugin {
+	return newTelegramPlugin(newState(defaultIdempotencySize, defaultIdempotencyTTL))
+})
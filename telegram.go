@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// telegramAPIBase is where Bot API requests go. Tests point it at a stub.
+var telegramAPIBase = "https://api.telegram.org"
+
+// Connection pool defaults for telegramClient, overridable with flags.
+const (
+	defaultMaxIdleConnsPerHost = 32
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// telegramClient sends every Bot API request, so connections to
+// api.telegram.org are kept alive and reused across calls instead of being
+// redialed. It has no overall timeout because getUpdates long-polls.
+var telegramClient = newTelegramClient(defaultMaxIdleConnsPerHost, defaultIdleConnTimeout)
+
+func newTelegramClient(maxIdlePerHost int, idleTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdlePerHost
+	transport.MaxIdleConnsPerHost = maxIdlePerHost
+	transport.IdleConnTimeout = idleTimeout
+	return &http.Client{Transport: transport}
+}
+
+// apiResponse is the envelope every Bot API method replies with.
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+	ErrorCode   int             `json:"error_code"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// apiError is a request Telegram received but rejected. Code is the Bot API
+// error_code, which mirrors the HTTP status.
+type apiError struct {
+	Method      string
+	Code        int
+	Description string
+	RetryAfter  int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("telegram %s failed (%d): %s", e.Method, e.Code, e.Description)
+}
+
+// message is the subset of a Telegram Message the plugin reports back.
+type message struct {
+	MessageID int64 `json:"message_id"`
+	Date      int64 `json:"date"`
+	Chat      struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	} `json:"chat"`
+}
+
+// upload is a file sent as a multipart form part.
+type upload struct {
+	field    string
+	filename string
+	data     []byte
+}
+
+// callTelegram invokes a Bot API method with form-encoded parameters and
+// decodes its result into out, which may be nil.
+func callTelegram(ctx context.Context, token, method string, form url.Values, out any) error {
+	env, err := postTelegram(ctx, token, method, form)
+	if err != nil {
+		return err
+	}
+	return decodeResult(method, env, out)
+}
+
+// postTelegram sends form to a Bot API method and returns the envelope of a
+// successful call, for the few methods whose description matters.
+func postTelegram(ctx context.Context, token, method string, form url.Values) (_ *apiResponse, err error) {
+	ctx, span := startAPISpan(ctx, method)
+	defer func() { endAPISpan(span, err) }()
+
+	req, err := newRequest(ctx, http.MethodPost, methodURL(token, method), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := telegramClient.Do(req)
+	if err != nil {
+		return nil, requestError(err)
+	}
+	defer resp.Body.Close()
+
+	return decodeEnvelope(method, resp)
+}
+
+// uploadTelegram is like callTelegram but sends files as multipart parts
+// alongside the form fields.
+func uploadTelegram(ctx context.Context, token, method string, form url.Values, files []upload, out any) (err error) {
+	if len(files) == 0 {
+		return callTelegram(ctx, token, method, form, out)
+	}
+	ctx, span := startAPISpan(ctx, method)
+	defer func() { endAPISpan(span, err) }()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for key, values := range form {
+		for _, v := range values {
+			if err := mw.WriteField(key, v); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range files {
+		part, err := mw.CreateFormFile(f.field, f.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	req, err := newRequest(ctx, http.MethodPost, methodURL(token, method), mw.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	resp, err := telegramClient.Do(req)
+	if err != nil {
+		return requestError(err)
+	}
+	defer resp.Body.Close()
+
+	env, err := decodeEnvelope(method, resp)
+	if err != nil {
+		return err
+	}
+	return decodeResult(method, env, out)
+}
+
+// downloadFile fetches a file previously resolved with getFile. It fails
+// rather than buffering more than maxBytes.
+func downloadFile(ctx context.Context, token, filePath string, maxBytes int64) (_ []byte, err error) {
+	ctx, span := startAPISpan(ctx, "file download")
+	defer func() { endAPISpan(span, err) }()
+
+	req, err := newRequest(ctx, http.MethodGet, fmt.Sprintf("%s/file/bot%s/%s", telegramAPIBase, token, filePath), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := telegramClient.Do(req)
+	if err != nil {
+		return nil, requestError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &apiError{Method: "file download", Code: resp.StatusCode, Description: resp.Status}
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("file is %d bytes, exceeds maxBytes %d: %w", resp.ContentLength, maxBytes, errTooLarge)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("file exceeds maxBytes %d: %w", maxBytes, errTooLarge)
+	}
+	return data, nil
+}
+
+// newRequest builds a Bot API request carrying the plugin's User-Agent and
+// the request ID of the call it is made for.
+func newRequest(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, requestError(err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	if id := correlationIDFrom(ctx); id != "" {
+		req.Header.Set("X-Correlation-ID", id)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func methodURL(token, method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", telegramAPIBase, token, method)
+}
+
+// requestError wraps a transport failure. The *url.Error returned by the
+// HTTP client embeds the request URL, which contains the bot token, so only
+// the underlying cause is kept.
+func requestError(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+	return fmt.Errorf("failed to send request: %w", err)
+}
+
+// decodeEnvelope reads a Bot API reply, turning ok=false into an *apiError.
+func decodeEnvelope(method string, resp *http.Response) (*apiResponse, error) {
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var env apiResponse
+	if err := json.Unmarshal(raw, &env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, &apiError{Method: method, Code: resp.StatusCode, Description: resp.Status}
+		}
+		return nil, fmt.Errorf("failed to decode telegram response: %w", err)
+	}
+	if !env.OK {
+		return nil, &apiError{
+			Method:      method,
+			Code:        env.ErrorCode,
+			Description: env.Description,
+			RetryAfter:  env.Parameters.RetryAfter,
+		}
+	}
+	return &env, nil
+}
+
+func decodeResult(method string, env *apiResponse, out any) error {
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(env.Result, out); err != nil {
+		return fmt.Errorf("failed to decode telegram %s result: %w", method, err)
+	}
+	return nil
+}
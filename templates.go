@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// templateParseModes maps a --templates-dir file's extension to the parse
+// mode its output is sent with. Other files in the directory are ignored.
+var templateParseModes = map[string]string{
+	".txt":  "",
+	".html": "HTML",
+	".md":   "MarkdownV2",
+}
+
+// templateFuncs escape variables for the parse modes; the built-in html
+// function covers HTML.
+var templateFuncs = template.FuncMap{
+	"escapeMarkdown": escapeV2,
+}
+
+// messageTemplate is one --templates-dir file, named by its file name
+// without the extension.
+type messageTemplate struct {
+	tmpl      *template.Template
+	parseMode string
+}
+
+// messageTemplates, set by --templates-dir, are the templates SendTemplate
+// renders. They are read once at startup.
+var messageTemplates map[string]*messageTemplate
+
+// loadTemplates parses the templates in dir.
+func loadTemplates(dir string) (map[string]*messageTemplate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --templates-dir: %w", err)
+	}
+	out := map[string]*messageTemplate{}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		mode, ok := templateParseModes[ext]
+		if !ok || e.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ext)
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("template %q is defined by more than one file in %s", name, dir)
+		}
+		src, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(string(src))
+		if err != nil {
+			return nil, err
+		}
+		out[name] = &messageTemplate{tmpl: tmpl, parseMode: mode}
+	}
+	return out, nil
+}
+
+// missingKey finds the variable text/template reports as missing.
+var missingKey = regexp.MustCompile(`map has no entry for key "([^"]*)"`)
+
+// render executes t with variables, naming the first missing variable if
+// there is one.
+func (t *messageTemplate) render(variables map[string]any) (string, error) {
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, variables); err != nil {
+		if m := missingKey.FindStringSubmatch(err.Error()); m != nil {
+			return "", argErrorf("template %q needs variable %q", t.tmpl.Name(), m[1])
+		}
+		return "", argErrorf("template %q failed to render: %v", t.tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+func templateNames() string {
+	names := make([]string, 0, len(messageTemplates))
+	for name := range messageTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// handleSendTemplate renders a --templates-dir template with variables and
+// sends it as SendMessage would, with the template's parse mode. The other
+// arguments (reply, silent, idempotency and so on) are passed on to
+// SendMessage unchanged.
+func (t *TelegramPlugin) handleSendTemplate(ctx context.Context, args map[string]any) sdk.Response {
+	name, _ := args["template"].(string)
+	if name == "" {
+		return invalidArgs("template is required")
+	}
+	if messageTemplates == nil {
+		return invalidArgs("no templates are loaded; start the plugin with --templates-dir")
+	}
+	tmpl, ok := messageTemplates[name]
+	if !ok {
+		return invalidArgs("unknown template %q; loaded templates: %s", name, templateNames())
+	}
+	var variables map[string]any
+	switch v := args["variables"].(type) {
+	case map[string]any:
+		variables = v
+	case map[string]string:
+		variables = make(map[string]any, len(v))
+		for k, val := range v {
+			variables[k] = val
+		}
+	case nil:
+		variables = map[string]any{}
+	default:
+		return invalidArgs("variables must be an object")
+	}
+
+	text, err := tmpl.render(variables)
+	if err != nil {
+		return fail(err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return invalidArgs("template %q rendered to empty text", name)
+	}
+
+	sendArgs := make(map[string]any, len(args))
+	for k, v := range args {
+		sendArgs[k] = v
+	}
+	delete(sendArgs, "template")
+	delete(sendArgs, "variables")
+	delete(sendArgs, "parseMode")
+	sendArgs["text"] = text
+	if tmpl.parseMode != "" {
+		sendArgs["parseMode"] = tmpl.parseMode
+	}
+	return t.handleSendMessage(ctx, sendArgs)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSendTemplateVariables(t *testing.T) {
+	p, stub := newStubbedPlugin(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deploy.html"), []byte("Deploy of <b>{{html .service}}</b> failed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := messageTemplates
+	messageTemplates = loaded
+	t.Cleanup(func() { messageTemplates = saved })
+
+	// Go callers may send variables as map[string]string, which gob
+	// carries as is.
+	for _, variables := range []any{
+		map[string]any{"service": "api"},
+		map[string]string{"service": "api"},
+	} {
+		call(t, p, "SendTemplate", map[string]any{"token": "1:T", "chatID": "1", "template": "deploy", "variables": variables})
+	}
+	if got := stub.count("sendMessage"); got != 2 {
+		t.Errorf("sendMessage called %d times, want 2", got)
+	}
+}
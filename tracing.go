@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer goes through the global provider, which is a no-op until
+// setupTracing installs an exporting one.
+var tracer = otel.Tracer("github.com/orka-platform/orka-telegram-plugin")
+
+// setupTracing exports spans over OTLP/HTTP to endpoint, e.g.
+// http://localhost:4318. The returned function flushes pending spans.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName("orka-telegram-plugin"),
+			semconv.ServiceVersion(pluginVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startCallSpan starts the span for one CallMethod invocation, as a child of
+// the caller's span when args["_trace"] carries a W3C traceparent. _trace is
+// either the traceparent string or an object with traceparent and
+// tracestate.
+func startCallSpan(ctx context.Context, req sdk.Request) (context.Context, trace.Span) {
+	carrier := propagation.MapCarrier{}
+	switch v := req.Args["_trace"].(type) {
+	case string:
+		carrier["traceparent"] = v
+	case map[string]any:
+		for k, val := range v {
+			if s, ok := val.(string); ok {
+				carrier[strings.ToLower(k)] = s
+			}
+		}
+	case map[string]string:
+		for k, s := range v {
+			carrier[strings.ToLower(k)] = s
+		}
+	}
+	ctx = propagation.TraceContext{}.Extract(ctx, carrier)
+
+	return tracer.Start(ctx, req.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("orka.plugin", pluginName),
+			attribute.String("orka.method", req.Method),
+			attribute.String("orka.request_id", requestIDFrom(ctx)),
+			attribute.String("orka.correlation_id", correlationIDFrom(ctx)),
+		))
+}
+
+func endCallSpan(span trace.Span, res *sdk.Response) {
+	if !res.Success {
+		if data, ok := res.Data.(map[string]any); ok {
+			if code, ok := data["errorCode"].(string); ok {
+				span.SetAttributes(attribute.String("orka.error_code", code))
+			}
+		}
+		span.SetStatus(codes.Error, res.Error)
+	}
+	span.End()
+}
+
+// startAPISpan starts a client span for one Bot API request. Its name and
+// attributes never include the request URL, which contains the token.
+func startAPISpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "telegram "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("telegram.method", method)))
+}
+
+func endAPISpan(span trace.Span, err error) {
+	if err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			span.SetAttributes(attribute.Int("telegram.error_code", apiErr.Code))
+		}
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
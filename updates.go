@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// updateKinds are the Update fields ProcessUpdate normalizes. An Update
+// carries exactly one of them next to update_id.
+var updateKinds = []string{
+	"message", "edited_message", "channel_post", "edited_channel_post",
+	"message_reaction", "inline_query", "chosen_inline_result", "callback_query",
+	"shipping_query", "pre_checkout_query", "poll", "poll_answer",
+	"my_chat_member", "chat_member", "chat_join_request",
+}
+
+// handleProcessUpdate normalizes an update. With expectedSecret, updates
+// whose secretToken (the webhook's X-Telegram-Bot-Api-Secret-Token header)
+// does not match are rejected before anything else is looked at.
+func (t *TelegramPlugin) handleProcessUpdate(ctx context.Context, args map[string]any) sdk.Response {
+	if expected, _ := args["expectedSecret"].(string); expected != "" {
+		provided, _ := args["secretToken"].(string)
+		if !webhookSecretMatches(provided, expected) {
+			return fail(fmt.Errorf("%w; update rejected", errUnverifiedUpdate))
+		}
+	}
+
+	var update map[string]any
+	switch v := args["update"].(type) {
+	case map[string]any:
+		update = v
+	case string:
+		if err := json.Unmarshal([]byte(v), &update); err != nil || update == nil {
+			return invalidArgs("update must be a JSON object")
+		}
+	case nil:
+		return invalidArgs("update is required")
+	default:
+		return invalidArgs("update must be an object")
+	}
+	return succeed(normalizeUpdate(update))
+}
+
+// normalizeUpdate flattens a Telegram Update into an event with the same
+// handful of fields whatever its kind. Ids are returned as decimal strings;
+// fields an update does not carry are left out.
+func normalizeUpdate(update map[string]any) map[string]any {
+	event := map[string]any{}
+	setField(event, "updateID", idField(update, "update_id"))
+
+	for _, kind := range updateKinds {
+		body, ok := update[kind].(map[string]any)
+		if !ok {
+			continue
+		}
+		event["type"] = kind
+
+		switch kind {
+		case "message", "edited_message", "channel_post", "edited_channel_post":
+			setField(event, "chatID", idField(body, "chat", "id"))
+			setField(event, "userID", idField(body, "from", "id"))
+			setField(event, "messageID", idField(body, "message_id"))
+			text := stringField(body, "text")
+			if text == "" {
+				text = stringField(body, "caption")
+			}
+			setField(event, "text", text)
+		case "message_reaction":
+			setField(event, "chatID", idField(body, "chat", "id"))
+			setField(event, "userID", idField(body, "user", "id"))
+			setField(event, "messageID", idField(body, "message_id"))
+		case "inline_query":
+			setField(event, "queryID", stringField(body, "id"))
+			setField(event, "userID", idField(body, "from", "id"))
+			setField(event, "text", stringField(body, "query"))
+		case "chosen_inline_result":
+			setField(event, "userID", idField(body, "from", "id"))
+			setField(event, "text", stringField(body, "query"))
+			setField(event, "data", stringField(body, "result_id"))
+		case "callback_query":
+			setField(event, "queryID", stringField(body, "id"))
+			setField(event, "userID", idField(body, "from", "id"))
+			setField(event, "chatID", idField(body, "message", "chat", "id"))
+			setField(event, "messageID", idField(body, "message", "message_id"))
+			setField(event, "data", stringField(body, "data"))
+		case "shipping_query", "pre_checkout_query":
+			setField(event, "queryID", stringField(body, "id"))
+			setField(event, "userID", idField(body, "from", "id"))
+			setField(event, "data", stringField(body, "invoice_payload"))
+		case "poll":
+			setField(event, "data", stringField(body, "id"))
+		case "poll_answer":
+			setField(event, "userID", idField(body, "user", "id"))
+			setField(event, "data", stringField(body, "poll_id"))
+		case "my_chat_member", "chat_member":
+			setField(event, "chatID", idField(body, "chat", "id"))
+			setField(event, "userID", idField(body, "from", "id"))
+			setField(event, "data", stringField(body, "new_chat_member", "status"))
+		case "chat_join_request":
+			setField(event, "chatID", idField(body, "chat", "id"))
+			setField(event, "userID", idField(body, "from", "id"))
+		}
+		return event
+	}
+
+	event["type"] = "unknown"
+	event["raw"] = update
+	return event
+}
+
+func setField(event map[string]any, key, value string) {
+	if value != "" {
+		event[key] = value
+	}
+}
+
+// lookup follows path through nested objects.
+func lookup(m map[string]any, path ...string) any {
+	var v any = m
+	for _, key := range path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+func stringField(m map[string]any, path ...string) string {
+	s, _ := lookup(m, path...).(string)
+	return s
+}
+
+// idField reads a numeric id, which arrives as float64 from JSON or as an
+// integer from callers that build the update themselves.
+func idField(m map[string]any, path ...string) string {
+	switch v := lookup(m, path...).(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return ""
+}
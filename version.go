@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	sdk "github.com/orka-platform/orka-plugin-sdk"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.buildVersion=v1.2.3 -X main.gitCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// Unset values fall back to config.json's version and the VCS details the
+// go command embeds when building from a checkout.
+var (
+	buildVersion string
+	gitCommit    string
+	buildDate    string
+)
+
+// buildInfo is the plugin's version, commit, build date and Go version.
+type buildInfo struct {
+	Version   string
+	GitCommit string
+	BuildDate string
+	GoVersion string
+}
+
+func currentBuild() buildInfo {
+	b := buildInfo{Version: buildVersion, GitCommit: gitCommit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if b.Version == "" {
+		b.Version = pluginVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && b.GitCommit == "":
+				b.GitCommit = s.Value
+			case s.Key == "vcs.time" && b.BuildDate == "":
+				b.BuildDate = s.Value
+			}
+		}
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	return fmt.Sprintf("orka-telegram-plugin %s (commit %s, built %s, %s)",
+		b.Version, orUnknown(b.GitCommit), orUnknown(b.BuildDate), b.GoVersion)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// handleVersion reports which build of the plugin is running.
+func (t *TelegramPlugin) handleVersion(ctx context.Context, args map[string]any) sdk.Response {
+	b := currentBuild()
+	return succeed(map[string]any{
+		"version":   b.Version,
+		"gitCommit": b.GitCommit,
+		"buildDate": b.BuildDate,
+		"goVersion": b.GoVersion,
+	})
+}